@@ -0,0 +1,71 @@
+package browser_manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// AssetOrigin is the origin renders fetch their assets from. Requests to it
+// never leave the browser: the request filter answers them with the AssetFunc
+// added to the render's context with WithAssets.
+const AssetOrigin = "https://" + assetHost
+
+// .invalid is reserved and never resolves, so nothing is fetched if a
+// request slips past the filter
+const assetHost = "assets.espresso.invalid"
+
+// ErrAssetNotFound is returned by an AssetFunc for paths it has no asset for.
+// The request is answered with a 404.
+var ErrAssetNotFound = errors.New("asset not found")
+
+// AssetFunc returns the content and content type of the asset at path, which
+// is relative to AssetOrigin and has no leading slash.
+type AssetFunc func(ctx context.Context, path string) ([]byte, string, error)
+
+type assetsKey struct{}
+
+// WithAssets returns a context whose renders are served their assets by fn.
+// Tabs acquired with the context answer requests to AssetOrigin with it for
+// the rest of the render.
+func WithAssets(ctx context.Context, fn AssetFunc) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, assetsKey{}, fn)
+}
+
+func contextAssets(ctx context.Context) AssetFunc {
+	fn, _ := ctx.Value(assetsKey{}).(AssetFunc)
+	return fn
+}
+
+// serveAsset answers h from fn. Tabs that are not bound to a render with
+// assets get a 404.
+func serveAsset(ctx context.Context, h *rod.Hijack, fn AssetFunc) {
+	u := h.Request.URL()
+	if fn == nil || h.Request.Method() != http.MethodGet {
+		h.Response.Payload().ResponseCode = http.StatusNotFound
+		return
+	}
+
+	content, contentType, err := fn(ctx, strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			log.Logger.Info(ctx, "template asset not found", map[string]any{"url": u.String()})
+			h.Response.Payload().ResponseCode = http.StatusNotFound
+			return
+		}
+		log.Logger.Error(ctx, "failed to serve template asset", err, map[string]any{"url": u.String()})
+		h.Response.Fail(proto.NetworkErrorReasonFailed)
+		return
+	}
+
+	h.Response.SetHeader("Content-Type", contentType, "Cache-Control", "no-store")
+	h.Response.SetBody(content)
+}
@@ -0,0 +1,93 @@
+package browser_manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Isolation modes decide which renders share cookies, storage, cache and
+// service workers. Stronger isolation costs more per render: a browser
+// context is cheap next to a process but still a few milliseconds of CDP
+// round trips to create and dispose.
+const (
+	// IsolationShared runs every tab in the browser's default context. It is
+	// the fastest, but state left by one render is visible to later ones.
+	IsolationShared = "shared"
+	// IsolationPerTab gives each tab its own incognito context for the tab's
+	// lifetime, so concurrent renders never share state. Cookies and cache
+	// are cleared between renders in the same tab, but storage that cannot
+	// be cleared through CDP without knowing the origin may survive.
+	IsolationPerTab = "per-tab"
+	// IsolationPerRequest disposes of the tab's context after every render
+	// and opens the next render in a fresh one. Nothing survives a render,
+	// at the cost of creating a context and tab per render.
+	IsolationPerRequest = "per-request"
+)
+
+func validateIsolation(isolation string) error {
+	switch isolation {
+	case IsolationShared, IsolationPerTab, IsolationPerRequest:
+		return nil
+	}
+	return fmt.Errorf("unknown isolation mode %q, use %s, %s or %s", isolation, IsolationShared, IsolationPerTab, IsolationPerRequest)
+}
+
+// openIsolatedTab opens a blank tab with the request filter attached. Unless
+// isolation is shared the tab gets its own browser context, returned as the
+// browser to dispose of with discardTab.
+func openIsolatedTab(browser *rod.Browser, isolation string) (*rod.Page, *rod.Browser, error) {
+	var incognito *rod.Browser
+	if isolation != IsolationShared {
+		var err error
+		if incognito, err = browser.Incognito(); err != nil {
+			return nil, nil, fmt.Errorf("failed to create browser context: %w", err)
+		}
+		browser = incognito
+	}
+
+	page, err := browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
+	if err != nil {
+		if incognito != nil {
+			incognito.Close()
+		}
+		return nil, nil, err
+	}
+	attachRequestFilter(page)
+	return page, incognito, nil
+}
+
+// discardTab closes page, disposing of its browser context if it has one.
+func discardTab(ctx context.Context, page *rod.Page, incognito *rod.Browser, timeout time.Duration) {
+	if incognito == nil {
+		closeTab(ctx, page, timeout)
+		return
+	}
+
+	b := incognito.Timeout(timeout)
+	defer b.CancelTimeout()
+
+	// disposing of the context closes its tabs too
+	if err := b.Close(); err != nil {
+		log.Logger.Error(ctx, "failed to dispose of browser context", err, nil)
+	}
+}
+
+// clearContext drops the cookies and cache a render left in an isolated
+// tab's context.
+func clearContext(page *rod.Page, incognito *rod.Browser, timeout time.Duration) error {
+	p := page.Timeout(timeout)
+	defer p.CancelTimeout()
+
+	if err := (proto.StorageClearCookies{BrowserContextID: incognito.BrowserContextID}).Call(p); err != nil {
+		return fmt.Errorf("failed to clear cookies: %w", err)
+	}
+	if err := (proto.NetworkClearBrowserCache{}).Call(p); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package browser_manager
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Launch presets are the base set of Chrome flags a LaunchConfig starts from.
+const (
+	// PresetPerformance trades browser security features for render speed
+	// and memory. Only safe when every template and the pages they load are
+	// trusted. The default.
+	PresetPerformance = "performance"
+	// PresetSecure is PresetPerformance with web security, site isolation and
+	// the sandbox left on. Chrome needs to run as a non-root user for the
+	// sandbox to start.
+	PresetSecure = "secure"
+	// PresetDebug is PresetPerformance with Chrome's logging and DevTools
+	// enabled, and the browser's output copied to stderr.
+	PresetDebug = "debug"
+)
+
+// LaunchConfig controls the flags launched browser processes are started
+// with. It is ignored for remote browsers.
+type LaunchConfig struct {
+	// Preset is PresetPerformance, PresetSecure or PresetDebug. Defaults to
+	// PresetPerformance.
+	Preset string
+	// Flags adds flags to the preset or overrides their values, keyed by name
+	// with or without the leading dashes. An empty value adds a switch.
+	Flags map[string]string
+	// RemoveFlags drops flags set by the preset.
+	RemoveFlags []string
+
+	// WindowWidth and WindowHeight set the browser window size. Either both
+	// or neither must be set.
+	WindowWidth  int
+	WindowHeight int
+	// Locale is the browser UI and Accept-Language locale, e.g. "en-US".
+	Locale string
+	// Timezone is an IANA timezone name, e.g. "Asia/Kolkata", used for dates
+	// rendered by page scripts.
+	Timezone string
+	// Proxy is the proxy every request goes through, e.g.
+	// "http://proxy:3128" or "socks5://proxy:1080".
+	Proxy string
+	// ProxyBypass lists hosts that skip Proxy, e.g. "localhost;*.internal".
+	ProxyBypass string
+}
+
+// flagSet maps flag names, without dashes, to their values. A nil value is a
+// switch.
+type flagSet map[string][]string
+
+var performanceFlags = flagSet{
+	"disable-gpu":                                        nil,
+	"no-first-run":                                       nil,
+	"no-default-browser-check":                           nil,
+	"disable-infobars":                                   nil,
+	"disable-dev-shm-usage":                              nil,
+	"disable-accelerated-2d-canvas":                      nil,
+	"disable-accelerated-video-decode":                   nil,
+	"disable-background-networking":                      nil,
+	"disable-background-timer-throttling":                nil,
+	"disable-translate":                                  nil,
+	"disable-sync":                                       nil,
+	"metrics-recording-only":                             nil,
+	"mute-audio":                                         nil,
+	"disable-web-security":                               nil,
+	"no-startup-window":                                  nil,
+	"disable-renderer-backgrounding":                     nil, // Prevent background throttling
+	"force-fieldtrials":                                  {"SiteIsolationExtensions/Disable"},
+	"disable-hyperlink-auditing":                         nil,
+	"disable-site-isolation-trials":                      nil,
+	"disable-host-resolver":                              nil,
+	"dns-prefetch-disable":                               nil,
+	"disable-logging":                                    nil,
+	"disable-breakpad":                                   nil,
+	"disable-devtools":                                   nil,
+	"disable-threaded-animation":                         nil,
+	"disable-threaded-scrolling":                         nil,
+	"disable-histogram-customizer":                       nil,
+	"disable-notifications":                              nil,
+	"disable-component-update":                           nil,
+	"enable-low-end-device-mode":                         nil,
+	"disable-partitioning":                               nil,
+	"disable-backgrounding-occluded-windows":             nil,
+	"force-low-power-mode":                               nil,
+	"disable-renderer-accessibility":                     nil,
+	"disable-cache":                                      nil,
+	"disable-prompt-on-repost":                           nil,
+	"disable-domain-reliability":                         nil,
+	"disable-features":                                   {"NetworkService,OutOfBlinkCors,InterestGroupStorage,UserAgentClientHint"},
+	"disable-extensions":                                 nil,
+	"disable-component-extensions-with-background-pages": nil,
+	"blink-settings":                                     {"autoplayPolicy=document-user-activation-required"},
+	"disable-blink-features":                             {"AutomationControlled,BackgroundTimers,BackForwardCache,MediaStream"},
+	"disable-software-rasterizer":                        nil,
+	"disable-background-downloads":                       nil,
+}
+
+// presetFlags returns a copy of the flags of preset, and the flags rod
+// launches Chrome with by default that the preset removes.
+func presetFlags(preset string) (flagSet, []string, error) {
+	flags := flagSet{}
+	for name, values := range performanceFlags {
+		flags[name] = values
+	}
+
+	switch preset {
+	case "", PresetPerformance:
+	case PresetSecure:
+		for _, name := range []string{"disable-web-security", "disable-site-isolation-trials", "force-fieldtrials", "disable-partitioning"} {
+			delete(flags, name)
+		}
+		flags["disable-features"] = []string{"InterestGroupStorage,UserAgentClientHint"}
+		// rod sets these itself, no-sandbox only when it detects a container
+		return flags, []string{"disable-site-isolation-trials", "no-sandbox"}, nil
+	case PresetDebug:
+		delete(flags, "disable-logging")
+		delete(flags, "disable-devtools")
+		flags["enable-logging"] = []string{"stderr"}
+		flags["v"] = []string{"1"}
+	default:
+		return nil, nil, fmt.Errorf("unknown browser preset %q, use %s, %s or %s", preset, PresetPerformance, PresetSecure, PresetDebug)
+	}
+	return flags, nil, nil
+}
+
+// reservedFlags are set by the manager for each browser process and cannot
+// be overridden.
+var reservedFlags = map[string]string{
+	"user-data-dir":            "set Config.UserDataDir instead",
+	"remote-debugging-port":    "each browser is given a free port",
+	"remote-debugging-address": "each browser is given a free port",
+}
+
+var (
+	flagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	localePattern   = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
+// flags returns the Chrome flags for c, other than the ones the launcher
+// manages itself, and the launcher defaults to remove. Flags wins over
+// RemoveFlags for a flag in both.
+func (c LaunchConfig) flags() (flagSet, []string, error) {
+	flags, removed, err := presetFlags(c.Preset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range c.RemoveFlags {
+		name = strings.TrimLeft(name, "-")
+		if err := checkFlagName(name); err != nil {
+			return nil, nil, err
+		}
+		delete(flags, name)
+		removed = append(removed, name)
+	}
+
+	for name, value := range c.Flags {
+		name = strings.TrimLeft(name, "-")
+		if err := checkFlagName(name); err != nil {
+			return nil, nil, err
+		}
+		flags[name] = nil
+		if value != "" {
+			flags[name] = []string{value}
+		}
+	}
+
+	if (c.WindowWidth == 0) != (c.WindowHeight == 0) || c.WindowWidth < 0 || c.WindowHeight < 0 {
+		return nil, nil, fmt.Errorf("invalid window size %dx%d, set both width and height", c.WindowWidth, c.WindowHeight)
+	}
+	if c.WindowWidth > 0 {
+		flags["window-size"] = []string{fmt.Sprintf("%d,%d", c.WindowWidth, c.WindowHeight)}
+	}
+
+	if c.Locale != "" {
+		if !localePattern.MatchString(c.Locale) {
+			return nil, nil, fmt.Errorf("invalid browser locale %q", c.Locale)
+		}
+		flags["lang"] = []string{c.Locale}
+		flags["accept-lang"] = []string{c.Locale}
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid browser timezone %q: %v", c.Timezone, err)
+		}
+	}
+
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid browser proxy %q", redactURL(c.Proxy))
+		}
+		switch u.Scheme {
+		case "http", "https", "socks4", "socks5":
+		default:
+			return nil, nil, fmt.Errorf("unsupported proxy scheme %q, use http, https, socks4 or socks5", u.Scheme)
+		}
+		flags["proxy-server"] = []string{c.Proxy}
+		if c.ProxyBypass != "" {
+			flags["proxy-bypass-list"] = []string{c.ProxyBypass}
+		}
+	} else if c.ProxyBypass != "" {
+		return nil, nil, fmt.Errorf("browser proxy bypass list set without a proxy")
+	}
+
+	return flags, removed, nil
+}
+
+func checkFlagName(name string) error {
+	if !flagNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid browser flag %q", name)
+	}
+	if why, ok := reservedFlags[name]; ok {
+		return fmt.Errorf("browser flag %q cannot be set: %s", name, why)
+	}
+	return nil
+}
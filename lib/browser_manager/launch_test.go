@@ -0,0 +1,62 @@
+package browser_manager
+
+import (
+	"testing"
+
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLauncherFlags(t *testing.T) {
+	l, err := newLauncher("chrome", "/tmp/chrome-user-data/0", LaunchConfig{
+		Preset:      PresetSecure,
+		Flags:       map[string]string{"--force-color-profile": "srgb", "disable-pinch": ""},
+		RemoveFlags: []string{"disable-cache"},
+		WindowWidth: 1280, WindowHeight: 720,
+		Locale:   "en-IN",
+		Timezone: "Asia/Kolkata",
+		Proxy:    "http://proxy:3128",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/tmp/chrome-user-data/0", l.Get(flags.UserDataDir))
+	assert.False(t, l.Has("disable-web-security"))
+	assert.False(t, l.Has("disable-site-isolation-trials"))
+	assert.False(t, l.Has(flags.NoSandbox))
+	assert.False(t, l.Has("disable-cache"))
+	assert.True(t, l.Has("disable-pinch"))
+	assert.Equal(t, "srgb", l.Get("force-color-profile"))
+	assert.Equal(t, "1280,720", l.Get("window-size"))
+	assert.Equal(t, "en-IN", l.Get("lang"))
+	assert.Equal(t, "http://proxy:3128", l.Get(flags.ProxyServer))
+
+	env, _ := l.GetFlags(flags.Env)
+	assert.Contains(t, env, "TZ=Asia/Kolkata")
+}
+
+func TestLaunchConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		conf LaunchConfig
+		err  string
+	}{
+		{"unknown_preset", LaunchConfig{Preset: "fast"}, `unknown browser preset "fast"`},
+		{"invalid_flag", LaunchConfig{Flags: map[string]string{"lang=en": ""}}, `invalid browser flag "lang=en"`},
+		{"reserved_flag", LaunchConfig{Flags: map[string]string{"--user-data-dir": "/data"}}, "set Config.UserDataDir instead"},
+		{"half_window_size", LaunchConfig{WindowWidth: 1280}, "set both width and height"},
+		{"invalid_locale", LaunchConfig{Locale: "en_US"}, `invalid browser locale "en_US"`},
+		{"invalid_timezone", LaunchConfig{Timezone: "Mars/Olympus"}, `invalid browser timezone "Mars/Olympus"`},
+		{"proxy_scheme", LaunchConfig{Proxy: "ftp://proxy:21"}, `unsupported proxy scheme "ftp"`},
+		{"bypass_without_proxy", LaunchConfig{ProxyBypass: "localhost"}, "without a proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.conf.flags()
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	_, _, err := LaunchConfig{}.flags()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,383 @@
+package browser_manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+)
+
+const defaultUserDataDir = "/tmp/chrome-user-data"
+
+var errManagerClosed = errors.New("browser manager closed")
+
+// Config describes the browser processes run by a Manager.
+type Config struct {
+	// BrowserBin is the Chrome binary. Defaults to $ROD_BROWSER_BIN.
+	BrowserBin string
+	// Browsers is the number of browser processes. Defaults to 1, and is
+	// one per URL with Remote.
+	Browsers int
+	// TabsPerBrowser is the size of each browser's tab pool. With 0, a new
+	// tab is opened for every render and closed afterwards.
+	TabsPerBrowser int
+	// UserDataDir is the parent of the per-browser user-data dirs. Defaults
+	// to /tmp/chrome-user-data.
+	UserDataDir string
+	// Isolation is IsolationShared, IsolationPerTab or IsolationPerRequest.
+	// Defaults to IsolationShared.
+	Isolation string
+
+	// Launch sets the flags launched browsers are started with.
+	Launch LaunchConfig
+	// Remote connects to running browsers instead of launching them when
+	// it has URLs.
+	Remote RemoteConfig
+
+	Queue      QueueConfig
+	Lifecycle  LifecycleConfig
+	Supervisor SupervisorConfig
+}
+
+// Stats describe every browser run by a Manager.
+type Stats struct {
+	Browsers []BrowserStats `json:"browsers"`
+	// Restarts is the total across browsers.
+	Restarts int64 `json:"restarts"`
+	// Waiting is the number of callers queued for a tab.
+	Waiting int `json:"waiting"`
+}
+
+// Manager runs a set of independent, supervised browser processes and hands
+// out tabs from whichever has the most idle tabs.
+type Manager struct {
+	conf   Config
+	shards []*shard
+	cancel context.CancelFunc
+	// done is closed by Close.
+	done <-chan struct{}
+
+	// waiting is the number of GetTab calls blocked on busy pools.
+	waiting atomic.Int32
+
+	mu sync.Mutex
+	// inUse maps every tab handed out to where it has to be returned.
+	inUse map[*rod.Page]tabOwner
+}
+
+type tabOwner struct {
+	shard *shard
+	// pool is nil for tabs opened per render.
+	pool *TabPool
+	// context is the browser context of a tab opened per render, if any.
+	context *rod.Browser
+}
+
+// New launches conf.Browsers browser processes and their tab pools and starts
+// supervising them. Close stops them.
+func New(ctx context.Context, conf Config) (*Manager, error) {
+	remote := len(conf.Remote.URLs) > 0
+	if remote {
+		conf.Browsers = len(conf.Remote.URLs)
+	} else {
+		if conf.BrowserBin == "" {
+			conf.BrowserBin = os.Getenv("ROD_BROWSER_BIN")
+		}
+		if conf.BrowserBin == "" {
+			return nil, fmt.Errorf("ROD_BROWSER_BIN environment variable not set")
+		}
+		if _, _, err := conf.Launch.flags(); err != nil {
+			return nil, fmt.Errorf("invalid browser launch config: %w", err)
+		}
+	}
+	if conf.Browsers <= 0 {
+		conf.Browsers = 1
+	}
+	if conf.UserDataDir == "" {
+		conf.UserDataDir = defaultUserDataDir
+	}
+	if conf.Isolation == "" {
+		conf.Isolation = IsolationShared
+	}
+	if err := validateIsolation(conf.Isolation); err != nil {
+		return nil, err
+	}
+
+	log.Logger.Info(ctx, "Initializing Browser...", map[string]any{"browsers": conf.Browsers, "tabsPerBrowser": conf.TabsPerBrowser, "isolation": conf.Isolation, "preset": conf.Launch.Preset})
+
+	superviseCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m := &Manager{
+		conf:   conf,
+		cancel: cancel,
+		done:   superviseCtx.Done(),
+		inUse:  map[*rod.Page]tabOwner{},
+	}
+
+	for i := 0; i < conf.Browsers; i++ {
+		s := newShard(i, filepath.Join(conf.UserDataDir, strconv.Itoa(i)), &m.conf)
+		if remote {
+			s = newRemoteShard(i, conf.Remote.URLs[i], &m.conf)
+		}
+		if err := s.start(ctx); err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to start browser %d: %w", i, err)
+		}
+		m.shards = append(m.shards, s)
+	}
+
+	for _, s := range m.shards {
+		go s.supervise(superviseCtx)
+	}
+
+	return m, nil
+}
+
+// Close stops supervision, kills every launched browser process and
+// disconnects from remote ones.
+func (m *Manager) Close() {
+	m.cancel()
+	for _, s := range m.shards {
+		s.stop()
+	}
+}
+
+// TotalTabs is the number of pooled tabs across browsers, 0 when tabs are
+// opened per render.
+func (m *Manager) TotalTabs() int {
+	return m.conf.Browsers * m.conf.TabsPerBrowser
+}
+
+// Stats reports the state of every browser.
+func (m *Manager) Stats() Stats {
+	stats := Stats{Waiting: int(m.waiting.Load())}
+	for _, s := range m.shards {
+		browserStats := s.snapshot()
+		stats.Browsers = append(stats.Browsers, browserStats)
+		stats.Restarts += browserStats.Restarts
+	}
+	return stats
+}
+
+// WithTab runs fn with a tab and releases the tab afterwards. If fn fails
+// because the tab's browser was lost, fn is retried once on a tab from the
+// relaunched browser. If fn fails with a context error the tab is discarded,
+// since Chrome may still be busy with the abandoned render.
+func (m *Manager) WithTab(ctx context.Context, fn func(page *rod.Page) error) error {
+	s, generation, err := m.runWithTab(ctx, fn)
+	if err != nil && s != nil && s.awaitRecovery(ctx, generation) {
+		log.Logger.Warn(ctx, "browser was relaunched during render, retrying", map[string]any{"browser": s.id, "error": err.Error()})
+		_, _, err = m.runWithTab(ctx, fn)
+	}
+	return err
+}
+
+func (m *Manager) runWithTab(ctx context.Context, fn func(page *rod.Page) error) (*shard, uint64, error) {
+	s, page, generation, err := m.acquire(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get browser tab: %w", err)
+	}
+	// a tab left by a panic in fn is discarded too
+	broken := true
+	defer func() { m.release(page, broken) }()
+
+	err = fn(page)
+	broken = errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+	return s, generation, err
+}
+
+// GetTab hands out a tab from the least loaded browser, waiting until one is
+// released, ctx is done or the queue limits are hit. Tabs must be returned
+// with ReleaseTab.
+func (m *Manager) GetTab(ctx context.Context) (*rod.Page, error) {
+	_, page, _, err := m.acquire(ctx)
+	return page, err
+}
+
+// ReleaseTab returns a tab to its pool. The tab is health checked first and
+// replaced in the background if it is unresponsive or due for recycling, so
+// a broken tab never goes back into the pool.
+func (m *Manager) ReleaseTab(page *rod.Page) {
+	m.release(page, false)
+}
+
+// DiscardTab closes a tab that cannot be reused, such as one whose render
+// timed out or was cancelled and may still be running, and opens a fresh
+// one in its place.
+func (m *Manager) DiscardTab(page *rod.Page) {
+	m.release(page, true)
+}
+
+func (m *Manager) release(page *rod.Page, broken bool) {
+	ctx := context.Background()
+	log.Logger.Info(ctx, "Releasing Tab", map[string]any{"discard": broken})
+
+	m.mu.Lock()
+	owner, ok := m.inUse[page]
+	delete(m.inUse, page)
+	m.mu.Unlock()
+	unbindRender(page)
+
+	switch {
+	case !ok:
+		closeTab(ctx, page, m.conf.Lifecycle.probeTimeout())
+	case owner.pool != nil:
+		// a pool retired by a relaunch discards the tab instead
+		owner.pool.release(ctx, page, broken)
+	default:
+		owner.shard.inFlight.Add(-1)
+		discardTab(ctx, page, owner.context, m.conf.Lifecycle.probeTimeout())
+	}
+}
+
+func (m *Manager) track(ctx context.Context, page *rod.Page, owner tabOwner) {
+	m.mu.Lock()
+	m.inUse[page] = owner
+	m.mu.Unlock()
+	bindRender(ctx, page)
+}
+
+func (m *Manager) acquire(ctx context.Context) (*shard, *rod.Page, uint64, error) {
+	log.Logger.Info(ctx, "Getting tab", nil)
+	if m.conf.TabsPerBrowser == 0 {
+		return m.openTab(ctx)
+	}
+
+	if s, pool, page := m.takeIdle(); page != nil {
+		m.track(ctx, page, tabOwner{shard: s, pool: pool})
+		return s, page, pool.generation, nil
+	}
+
+	waiting := int(m.waiting.Add(1))
+	defer m.waiting.Add(-1)
+	if m.conf.Queue.MaxQueueDepth > 0 && waiting > m.conf.Queue.MaxQueueDepth {
+		return nil, nil, 0, &OverloadedError{Waiting: waiting - 1, Reason: "tab queue is full"}
+	}
+
+	waitCtx := ctx
+	if m.conf.Queue.AcquireTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, m.conf.Queue.AcquireTimeout)
+		defer cancel()
+	}
+
+	for {
+		s, pool, page, err := m.waitForTab(waitCtx)
+		if err == errPoolClosed {
+			// a browser was relaunched, wait on its new pool
+			continue
+		}
+		if err == errManagerClosed {
+			return nil, nil, 0, err
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, 0, fmt.Errorf("gave up waiting for a tab: %w", ctx.Err())
+			}
+			return nil, nil, 0, &OverloadedError{Waiting: int(m.waiting.Load()), Reason: "timed out waiting for a tab"}
+		}
+		m.track(ctx, page, tabOwner{shard: s, pool: pool})
+		return s, page, pool.generation, nil
+	}
+}
+
+// takeIdle takes a tab from the browser with the most idle tabs, if any.
+func (m *Manager) takeIdle() (*shard, *TabPool, *rod.Page) {
+	for {
+		var best *shard
+		var bestPool *TabPool
+		for _, s := range m.shards {
+			pool := s.currentPool()
+			if pool == nil || pool.isClosed() {
+				continue
+			}
+			if bestPool == nil || pool.idle() > bestPool.idle() {
+				best, bestPool = s, pool
+			}
+		}
+		if bestPool == nil || bestPool.idle() == 0 {
+			return nil, nil, nil
+		}
+
+		select {
+		case page := <-bestPool.pool:
+			return best, bestPool, page
+		default:
+			// raced with another caller, look again
+		}
+	}
+}
+
+// waitForTab blocks until any browser releases a tab, a browser is
+// relaunched or ctx is done. errPoolClosed means the set of pools changed and
+// the caller should wait again.
+func (m *Manager) waitForTab(ctx context.Context) (*shard, *TabPool, *rod.Page, error) {
+	recv := func(ch any) reflect.SelectCase {
+		return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+	}
+
+	// pools[i] is the pool received from by cases[i], nil for the cases
+	// that only wake the caller up
+	cases := []reflect.SelectCase{recv(ctx.Done()), recv(m.done)}
+	pools := []*TabPool{nil, nil}
+	shards := []*shard{nil, nil}
+	for _, s := range m.shards {
+		s.mu.Lock()
+		pool, ready := s.pool, s.ready
+		s.mu.Unlock()
+
+		if pool.isClosed() {
+			// being relaunched, wake up once the new pool is ready
+			cases, pools, shards = append(cases, recv(ready)), append(pools, nil), append(shards, nil)
+			continue
+		}
+		cases = append(cases, recv(pool.pool), recv(pool.closed))
+		pools = append(pools, pool, nil)
+		shards = append(shards, s, nil)
+	}
+
+	chosen, value, _ := reflect.Select(cases)
+	switch {
+	case chosen == 0:
+		return nil, nil, nil, ctx.Err()
+	case chosen == 1:
+		return nil, nil, nil, errManagerClosed
+	case pools[chosen] == nil:
+		return nil, nil, nil, errPoolClosed
+	}
+	return shards[chosen], pools[chosen], value.Interface().(*rod.Page), nil
+}
+
+// openTab opens a tab on the browser with the fewest renders in flight.
+func (m *Manager) openTab(ctx context.Context) (*shard, *rod.Page, uint64, error) {
+	best := m.shards[0]
+	for _, s := range m.shards[1:] {
+		if s.inFlight.Load() < best.inFlight.Load() {
+			best = s
+		}
+	}
+
+	generation, ready := best.state()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return nil, nil, 0, fmt.Errorf("gave up waiting for the browser: %w", ctx.Err())
+	}
+
+	// a tab that lives for one render is per-request isolated either way
+	page, incognito, err := openIsolatedTab(best.currentBrowser(), m.conf.Isolation)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to open tab: %w", err)
+	}
+
+	best.inFlight.Add(1)
+	m.track(ctx, page, tabOwner{shard: best, context: incognito})
+	return best, page, generation, nil
+}
@@ -0,0 +1,130 @@
+package browser_manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManager returns a manager over pools with the given idle tabs and
+// no browsers behind them.
+func newTestManager(conf Config, idle ...int) (*Manager, []*TabPool) {
+	done := make(chan struct{})
+	m := &Manager{conf: conf, done: done, cancel: func() { close(done) }, inUse: map[*rod.Page]tabOwner{}}
+	m.conf.TabsPerBrowser = 2
+
+	var pools []*TabPool
+	for i, n := range idle {
+		pool := &TabPool{pool: make(chan *rod.Page, 2), tabs: map[*rod.Page]*tabState{}, closed: make(chan struct{})}
+		for j := 0; j < n; j++ {
+			page := &rod.Page{}
+			pool.tabs[page] = &tabState{}
+			pool.pool <- page
+		}
+		s := newShard(i, "", &m.conf)
+		s.pool = pool
+		close(s.ready)
+
+		m.shards = append(m.shards, s)
+		pools = append(pools, pool)
+	}
+	return m, pools
+}
+
+func TestGetTabDispatchesToLeastLoaded(t *testing.T) {
+	m, pools := newTestManager(Config{}, 1, 2)
+
+	_, err := m.GetTab(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pools[0].idle())
+	assert.Equal(t, 1, pools[1].idle())
+}
+
+func TestGetTabQueueLimits(t *testing.T) {
+	t.Run("context_deadline", func(t *testing.T) {
+		m, _ := newTestManager(Config{}, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := m.GetTab(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("acquire_timeout", func(t *testing.T) {
+		m, _ := newTestManager(Config{Queue: QueueConfig{AcquireTimeout: 20 * time.Millisecond}}, 0)
+
+		_, err := m.GetTab(context.Background())
+		var overloaded *OverloadedError
+		assert.True(t, errors.As(err, &overloaded))
+	})
+
+	t.Run("queue_full", func(t *testing.T) {
+		m, _ := newTestManager(Config{Queue: QueueConfig{MaxQueueDepth: 1}}, 0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := m.GetTab(ctx)
+			done <- err
+		}()
+		for m.waiting.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		_, err := m.GetTab(context.Background())
+		var overloaded *OverloadedError
+		assert.True(t, errors.As(err, &overloaded))
+		assert.Equal(t, 1, overloaded.Waiting)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("tab_released_on_any_browser_is_handed_out", func(t *testing.T) {
+		m, pools := newTestManager(Config{}, 0, 0)
+		page := &rod.Page{}
+		go func() {
+			for m.waiting.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			pools[1].pool <- page
+		}()
+
+		got, err := m.GetTab(context.Background())
+		assert.NoError(t, err)
+		assert.Same(t, page, got)
+	})
+
+	t.Run("waiters_move_to_relaunched_pool", func(t *testing.T) {
+		m, pools := newTestManager(Config{}, 0)
+		s := m.shards[0]
+		page := &rod.Page{}
+		go func() {
+			for m.waiting.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			_, ready := s.markLost(0, "test")
+			pools[0].close()
+
+			fresh := &TabPool{pool: make(chan *rod.Page, 1), closed: make(chan struct{}), generation: 1}
+			fresh.pool <- page
+			s.mu.Lock()
+			s.pool = fresh
+			close(ready)
+			s.mu.Unlock()
+		}()
+
+		got, err := m.GetTab(context.Background())
+		assert.NoError(t, err)
+		assert.Same(t, page, got)
+	})
+}
+
+func TestNewRejectsUnknownIsolation(t *testing.T) {
+	_, err := New(context.Background(), Config{BrowserBin: "chrome", Isolation: "per-tenant"})
+	assert.ErrorContains(t, err, `unknown isolation mode "per-tenant"`)
+}
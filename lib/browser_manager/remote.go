@@ -0,0 +1,137 @@
+package browser_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+// RemoteConfig connects to browsers that are already running, such as a
+// browserless sidecar or a pool of Chrome containers, instead of launching
+// them. Lost connections are re-established by the supervisor.
+type RemoteConfig struct {
+	// URLs are the DevTools endpoints, one browser per URL. Each is either a
+	// ws(s):// browser websocket URL or an http(s):// address whose
+	// /json/version reports one.
+	URLs []string
+	// Header is sent when connecting to the endpoints, e.g. for auth.
+	Header http.Header
+	// DialTimeout bounds connecting to an endpoint. Defaults to 10s.
+	DialTimeout time.Duration
+}
+
+func (c RemoteConfig) dialTimeout() time.Duration {
+	if c.DialTimeout > 0 {
+		return c.DialTimeout
+	}
+	return defaultDialTimeout
+}
+
+// connectBrowser connects to the browser at endpoint. Closing the returned
+// closer drops the connection without closing the remote browser.
+func connectBrowser(ctx context.Context, endpoint string, conf RemoteConfig) (*rod.Browser, io.Closer, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, conf.dialTimeout())
+	defer cancel()
+
+	wsURL, err := resolveRemoteURL(dialCtx, endpoint, conf.Header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve browser endpoint: %v", err)
+	}
+
+	ws := &cdp.WebSocket{}
+	if err := ws.Connect(dialCtx, wsURL, conf.Header); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to browser: %v", err)
+	}
+
+	browser := rod.New().Client(cdp.New().Start(ws))
+	if err := browser.Connect(); err != nil {
+		ws.Close()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %v", err)
+	}
+
+	log.Logger.Info(ctx, "Connected to remote browser", map[string]any{"endpoint": redactURL(endpoint)})
+
+	return browser, ws, nil
+}
+
+// resolveRemoteURL returns the websocket URL for endpoint, asking the
+// endpoint's /json/version for it when endpoint is an http(s) address.
+func resolveRemoteURL(ctx context.Context, endpoint string, header http.Header) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		return endpoint, nil
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported scheme %q, use ws, wss, http or https", u.Scheme)
+	}
+
+	versionURL := *u
+	versionURL.Path = "/json/version"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", versionURL.Path, resp.Status)
+	}
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("invalid %s response: %v", versionURL.Path, err)
+	}
+	if version.WebSocketDebuggerURL == "" {
+		return "", fmt.Errorf("%s did not report a webSocketDebuggerUrl", versionURL.Path)
+	}
+
+	// the browser reports its own address, which is usually not the one it is
+	// reachable on from here
+	wsURL, err := url.Parse(version.WebSocketDebuggerURL)
+	if err != nil {
+		return "", err
+	}
+	wsURL.Host = u.Host
+	wsURL.Scheme = "ws"
+	if u.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	}
+	wsURL.RawQuery = u.RawQuery
+	return wsURL.String(), nil
+}
+
+// redactURL drops credentials and query parameters, which often carry auth
+// tokens, before a URL is logged.
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,45 @@
+package browser_manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRemoteURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json/version" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"webSocketDebuggerUrl":"ws://127.0.0.1:9222/devtools/browser/abc"}`))
+	}))
+	defer server.Close()
+	header := http.Header{"Authorization": {"Bearer secret"}}
+
+	t.Run("websocket_url_is_used_as_is", func(t *testing.T) {
+		got, err := resolveRemoteURL(context.Background(), "wss://chrome.internal/?token=x", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "wss://chrome.internal/?token=x", got)
+	})
+
+	t.Run("http_url_is_resolved_on_the_given_host", func(t *testing.T) {
+		got, err := resolveRemoteURL(context.Background(), server.URL+"?token=x", header)
+		assert.NoError(t, err)
+		assert.Equal(t, "ws://"+strings.TrimPrefix(server.URL, "http://")+"/devtools/browser/abc?token=x", got)
+	})
+
+	t.Run("auth_failure", func(t *testing.T) {
+		_, err := resolveRemoteURL(context.Background(), server.URL, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported_scheme", func(t *testing.T) {
+		_, err := resolveRemoteURL(context.Background(), "ftp://chrome.internal", nil)
+		assert.Error(t, err)
+	})
+}
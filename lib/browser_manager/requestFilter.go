@@ -2,6 +2,7 @@ package browser_manager
 
 import (
 	"context"
+	"sync"
 
 	log "github.com/Zomato/espresso/lib/logger"
 	"github.com/go-rod/rod"
@@ -16,10 +17,42 @@ func isLocalScheme(s string) bool {
 	return false
 }
 
+// renderBinding is what the request filter of a tab applies on behalf of the
+// render it is serving: the lists added with WithAllowlist and the assets
+// added with WithAssets to the context the tab was acquired with.
+type renderBinding struct {
+	ctx        context.Context
+	allowlists []*Allowlist
+	assets     AssetFunc
+}
+
+// renderBindings maps tabs handed out to their *renderBinding.
+var renderBindings sync.Map
+
+func bindRender(ctx context.Context, page *rod.Page) {
+	b := &renderBinding{ctx: ctx, allowlists: contextAllowlists(ctx), assets: contextAssets(ctx)}
+	if len(b.allowlists) > 0 || b.assets != nil {
+		renderBindings.Store(page, b)
+	}
+}
+
+func unbindRender(page *rod.Page) {
+	renderBindings.Delete(page)
+}
+
+func boundRender(page *rod.Page) *renderBinding {
+	if b, ok := renderBindings.Load(page); ok {
+		return b.(*renderBinding)
+	}
+	return &renderBinding{ctx: context.Background()}
+}
+
 // attachRequestFilter installs a request hijacker on the page that blocks any
-// outbound request that fails the shared allowlist check in lib/common. The
-// allowlist is read live on every request, so hot-reloading via
-// common.SetAllowedDomains takes effect without re-initialising the pool.
+// outbound request that fails the allowlist check in IsURLAllowed, combined
+// with the lists bound to the render the tab is serving. Requests to
+// AssetOrigin are answered with the render's assets instead. The allowlist
+// is read live on every request, so hot-reloading via SetAllowedDomains takes
+// effect without re-initialising the pool.
 func attachRequestFilter(page *rod.Page) {
 	router := page.HijackRequests()
 	err := router.Add("*", "", func(h *rod.Hijack) {
@@ -37,7 +70,13 @@ func attachRequestFilter(page *rod.Page) {
 			return
 		}
 
-		if ok, reason := IsURLAllowed(u.String()); !ok {
+		render := boundRender(page)
+		if u.Host == assetHost {
+			serveAsset(render.ctx, h, render.assets)
+			return
+		}
+
+		if ok, reason := isURLAllowed(u.String(), render.allowlists); !ok {
 			log.Logger.Info(context.Background(), "blocked non-allowlisted url", map[string]any{"url": u.String(), "reason": reason})
 			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
 			return
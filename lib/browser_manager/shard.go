@@ -0,0 +1,324 @@
+package browser_manager
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	defaultPingInterval = 5 * time.Second
+	defaultPingFailures = 3
+	maxRelaunchBackoff  = 30 * time.Second
+)
+
+// SupervisorConfig controls how each browser process is watched. A closed
+// CDP connection is always treated as a lost browser; pings catch a browser
+// that is still connected but no longer answering.
+type SupervisorConfig struct {
+	// PingInterval is how often the browser is pinged. Defaults to 5s.
+	PingInterval time.Duration
+	// PingFailures is the number of consecutive failed pings after which the
+	// browser is relaunched. Defaults to 3.
+	PingFailures int
+}
+
+// BrowserStats describe one supervised browser, for health checks and
+// alerting.
+type BrowserStats struct {
+	ID                int       `json:"id"`
+	Endpoint          string    `json:"endpoint,omitempty"` // remote browsers only, without credentials
+	Connected         bool      `json:"connected"`
+	IdleTabs          int       `json:"idle_tabs"`
+	Restarts          int64     `json:"restarts"`
+	LastRestartAt     time.Time `json:"last_restart_at,omitempty"`
+	LastRestartReason string    `json:"last_restart_reason,omitempty"`
+}
+
+// shard is one browser with its own tab pool, either a process with its own
+// user-data dir or a remote endpoint. Its supervisor loop relaunches or
+// reconnects it when it is lost.
+type shard struct {
+	id          int
+	userDataDir string
+	remoteURL   string
+	conf        *Config
+
+	// inFlight counts tabs opened per render when there is no pool.
+	inFlight atomic.Int32
+
+	mu       sync.Mutex
+	browser  *rod.Browser
+	launcher *launcher.Launcher
+	// conn is the connection to a remote browser.
+	conn io.Closer
+	pool *TabPool
+	// generation is bumped every time the browser is found lost, so renders
+	// can tell whether the browser they used is still the current one.
+	generation uint64
+	// ready is closed while the current generation is connected.
+	ready chan struct{}
+	// lost wakes the watch loop when a render reports the browser lost.
+	lost  chan struct{}
+	stats BrowserStats
+}
+
+func newShard(id int, userDataDir string, conf *Config) *shard {
+	return &shard{
+		id:          id,
+		userDataDir: userDataDir,
+		conf:        conf,
+		ready:       make(chan struct{}),
+		lost:        make(chan struct{}, 1),
+		stats:       BrowserStats{ID: id},
+	}
+}
+
+func newRemoteShard(id int, remoteURL string, conf *Config) *shard {
+	s := newShard(id, "", conf)
+	s.remoteURL = remoteURL
+	s.stats.Endpoint = redactURL(remoteURL)
+	return s
+}
+
+func (s *shard) currentBrowser() *rod.Browser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.browser
+}
+
+func (s *shard) currentPool() *TabPool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pool
+}
+
+func (s *shard) state() (uint64, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation, s.ready
+}
+
+func (s *shard) snapshot() BrowserStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	if s.pool != nil {
+		stats.IdleTabs = s.pool.idle()
+	}
+	return stats
+}
+
+// start launches or connects to the browser, opens its tab pool and marks
+// the shard ready.
+func (s *shard) start(ctx context.Context) error {
+	var browser *rod.Browser
+	var l *launcher.Launcher
+	var conn io.Closer
+	var err error
+	if s.remoteURL != "" {
+		browser, conn, err = connectBrowser(ctx, s.remoteURL, s.conf.Remote)
+	} else {
+		browser, l, err = launchBrowser(ctx, s.conf.BrowserBin, s.userDataDir, s.conf.Launch)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+
+	var pool *TabPool
+	if s.conf.TabsPerBrowser > 0 {
+		if pool, err = NewTabPool(ctx, browser, s.conf.TabsPerBrowser, s.conf.Lifecycle, s.conf.Isolation); err != nil {
+			if l != nil {
+				l.Kill()
+			} else {
+				conn.Close()
+			}
+			return err
+		}
+		pool.generation = generation
+	}
+
+	s.mu.Lock()
+	s.browser, s.launcher, s.conn, s.pool = browser, l, conn, pool
+	s.stats.Connected = true
+	close(s.ready)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *shard) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool != nil {
+		s.pool.close()
+	}
+	if s.launcher != nil {
+		s.launcher.Kill()
+	}
+	if s.conn != nil {
+		// a remote browser outlives us, so close our idle tabs before
+		// dropping the connection rather than leaking them
+		go func(pool *TabPool, conn io.Closer) {
+			if pool != nil {
+				pool.drain()
+			}
+			conn.Close()
+		}(s.pool, s.conn)
+	}
+}
+
+// awaitRecovery reports whether a render failed because the browser was lost
+// since generation was read. If so, it waits for the relaunch to finish and
+// returns true. It returns false if the browser is healthy or ctx is done
+// first.
+func (s *shard) awaitRecovery(ctx context.Context, generation uint64) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	current, ready := s.state()
+	if current == generation {
+		if ping(s.currentBrowser()) == nil {
+			return false
+		}
+		_, ready = s.markLost(generation, "browser did not answer after a failed render")
+	}
+
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// markLost moves past generation, unless that already happened, and returns
+// the new generation with the channel closed once it is connected.
+func (s *shard) markLost(generation uint64, reason string) (uint64, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation == generation {
+		s.generation++
+		s.ready = make(chan struct{})
+		s.stats.Connected = false
+		s.stats.Restarts++
+		s.stats.LastRestartAt = time.Now()
+		s.stats.LastRestartReason = reason
+
+		select {
+		case s.lost <- struct{}{}:
+		default:
+		}
+	}
+	return s.generation, s.ready
+}
+
+// supervise relaunches the browser whenever it is lost, until ctx is done.
+func (s *shard) supervise(ctx context.Context) {
+	for {
+		generation, ready := s.state()
+		select {
+		case <-ready:
+			reason := s.watch(ctx, s.currentBrowser(), generation)
+			if ctx.Err() != nil {
+				return
+			}
+			s.markLost(generation, reason)
+			log.Logger.Warn(ctx, "browser lost, relaunching", map[string]any{"browser": s.id, "reason": reason})
+		default:
+			// a render reported the browser lost before it was watched
+			log.Logger.Warn(ctx, "browser lost, relaunching", map[string]any{"browser": s.id, "reason": s.snapshot().LastRestartReason})
+		}
+		s.relaunch(ctx)
+	}
+}
+
+// watch blocks until the browser is lost and returns why.
+func (s *shard) watch(ctx context.Context, browser *rod.Browser, generation uint64) string {
+	interval := s.conf.Supervisor.PingInterval
+	if interval <= 0 {
+		interval = defaultPingInterval
+	}
+	maxFailures := s.conf.Supervisor.PingFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultPingFailures
+	}
+
+	// the event stream closes with the CDP websocket
+	disconnected := make(chan struct{})
+	go func() {
+		for range browser.Event() {
+		}
+		close(disconnected)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-disconnected:
+			return "CDP connection closed"
+		case <-s.lost:
+			if current, _ := s.state(); current != generation {
+				return "reported lost by a render"
+			}
+		case <-ticker.C:
+			if err := ping(browser); err != nil {
+				failures++
+				log.Logger.Error(ctx, "browser ping failed", err, map[string]any{"browser": s.id, "failures": failures})
+				if failures >= maxFailures {
+					return "browser stopped answering pings"
+				}
+				continue
+			}
+			failures = 0
+		}
+	}
+}
+
+// relaunch replaces the browser process and the tab pool, retrying until it
+// succeeds or ctx is done.
+func (s *shard) relaunch(ctx context.Context) {
+	s.stop()
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := s.start(ctx)
+		if err == nil {
+			log.Logger.Info(ctx, "browser relaunched", map[string]any{"browser": s.id, "restarts": s.snapshot().Restarts})
+			return
+		}
+		log.Logger.Error(ctx, "failed to relaunch browser", err, map[string]any{"browser": s.id, "retryIn": backoff})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRelaunchBackoff {
+			backoff = maxRelaunchBackoff
+		}
+	}
+}
+
+func ping(browser *rod.Browser) error {
+	b := browser.Timeout(5 * time.Second)
+	defer b.CancelTimeout()
+	_, err := proto.BrowserGetVersion{}.Call(b)
+	return err
+}
@@ -0,0 +1,97 @@
+package browser_manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/internal/cdptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRemoteTestManager returns a manager with one pooled tab on a fake
+// browser.
+func newRemoteTestManager(t *testing.T, browser *cdptest.Server, lifecycle LifecycleConfig) *Manager {
+	m, err := New(context.Background(), Config{
+		TabsPerBrowser: 1,
+		Remote:         RemoteConfig{URLs: []string{browser.URL}},
+		Lifecycle:      lifecycle,
+		Supervisor:     SupervisorConfig{PingInterval: 20 * time.Millisecond},
+		Queue:          QueueConfig{AcquireTimeout: 100 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestSupervisorRelaunchesLostBrowser(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("crashed_browser", func(t *testing.T) {
+		browser := cdptest.NewServer()
+		t.Cleanup(browser.Close)
+		m := newRemoteTestManager(t, browser, LifecycleConfig{})
+
+		// the browser goes away and does not come back at once
+		browser.Refuse(true)
+		browser.Disconnect()
+		require.Eventually(t, func() bool { return !m.Stats().Browsers[0].Connected }, 5*time.Second, 10*time.Millisecond)
+
+		// no tab of the lost browser is handed out, and callers are not
+		// held past the acquire timeout
+		start := time.Now()
+		_, err := m.GetTab(ctx)
+		var overloaded *OverloadedError
+		assert.ErrorAs(t, err, &overloaded)
+		assert.Less(t, time.Since(start), time.Second)
+
+		browser.Refuse(false)
+		require.Eventually(t, func() bool { return m.Stats().Browsers[0].Connected }, 5*time.Second, 10*time.Millisecond)
+		page, err := m.GetTab(ctx)
+		require.NoError(t, err)
+		m.ReleaseTab(page)
+
+		stats := m.Stats()
+		assert.Equal(t, int64(1), stats.Restarts)
+		assert.Equal(t, "CDP connection closed", stats.Browsers[0].LastRestartReason)
+	})
+
+	t.Run("reported_lost", func(t *testing.T) {
+		browser := cdptest.NewServer()
+		t.Cleanup(browser.Close)
+		m := newRemoteTestManager(t, browser, LifecycleConfig{})
+		s := m.shards[0]
+
+		page, err := m.GetTab(ctx)
+		require.NoError(t, err)
+		before := browser.Target(string(page.SessionID))
+
+		generation, _ := s.state()
+		next, ready := s.markLost(generation, "test")
+		assert.Equal(t, generation+1, next)
+		// reporting the same generation twice restarts it once
+		again, _ := s.markLost(generation, "test")
+		assert.Equal(t, next, again)
+
+		select {
+		case <-ready:
+		case <-time.After(5 * time.Second):
+			t.Fatal("browser was not relaunched")
+		}
+		// the tab of the lost browser is not pooled again
+		m.ReleaseTab(page)
+		stats := m.Stats()
+		assert.Equal(t, 1, stats.Browsers[0].IdleTabs)
+
+		fresh, err := m.GetTab(ctx)
+		require.NoError(t, err)
+		assert.NotEqual(t, before, browser.Target(string(fresh.SessionID)))
+		m.ReleaseTab(fresh)
+
+		stats = m.Stats()
+		assert.Equal(t, int64(1), stats.Restarts)
+		assert.Equal(t, "test", stats.Browsers[0].LastRestartReason)
+		assert.True(t, stats.Browsers[0].Connected)
+	})
+}
@@ -0,0 +1,180 @@
+package browser_manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Zomato/espresso/lib/logger"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	maxReplaceBackoff   = 10 * time.Second
+)
+
+// LifecycleConfig controls when pooled tabs are recycled. Unresponsive tabs
+// are always replaced.
+type LifecycleConfig struct {
+	// ProbeTimeout bounds the health probe run on every released tab.
+	// Defaults to 5s.
+	ProbeTimeout time.Duration
+	// MaxRenders recycles a tab after it has served this many renders. 0
+	// disables recycling by count.
+	MaxRenders int
+	// MaxHeapBytes recycles a tab once its JS heap is larger than this after
+	// a render. 0 disables the check.
+	MaxHeapBytes int64
+}
+
+func (c LifecycleConfig) probeTimeout() time.Duration {
+	if c.ProbeTimeout > 0 {
+		return c.ProbeTimeout
+	}
+	return defaultProbeTimeout
+}
+
+// probeTab clears the tab and reads its JS heap size. An error means the tab
+// or its renderer is hung or gone.
+func probeTab(page *rod.Page, timeout time.Duration) (float64, error) {
+	p := page.Timeout(timeout)
+	defer p.CancelTimeout()
+
+	if err := p.SetDocumentContent(""); err != nil {
+		return 0, fmt.Errorf("failed to clear tab: %w", err)
+	}
+	usage, err := proto.RuntimeGetHeapUsage{}.Call(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read heap usage: %w", err)
+	}
+	return usage.UsedSize, nil
+}
+
+func (p *TabPool) newTab() (*rod.Page, error) {
+	page, incognito, err := openIsolatedTab(p.browser, p.isolation)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.tabs[page] = &tabState{context: incognito}
+	p.mu.Unlock()
+	return page, nil
+}
+
+// release returns page to the pool, or replaces it if it fails the health
+// probe, is due for recycling or broken is set.
+func (p *TabPool) release(ctx context.Context, page *rod.Page, broken bool) {
+	p.mu.Lock()
+	state, owned := p.tabs[page]
+	renders := 0
+	if owned {
+		state.renders++
+		renders = state.renders
+	}
+	p.mu.Unlock()
+
+	if !owned {
+		closeTab(ctx, page, p.lifecycle.probeTimeout())
+		return
+	}
+	// a tab from a pool retired by a browser relaunch
+	if p.isClosed() {
+		p.discard(ctx, page, state)
+		return
+	}
+
+	reason := ""
+	var heapUsed float64
+	if broken {
+		// may still be busy printing or running the page's scripts
+		reason = "render abandoned"
+	} else if p.isolation == IsolationPerRequest {
+		// every render gets a fresh context, no point probing this one
+		reason = "per-request isolation"
+	} else {
+		var err error
+		heapUsed, err = probeTab(page, p.lifecycle.probeTimeout())
+		if err == nil && state.context != nil {
+			err = clearContext(page, state.context, p.lifecycle.probeTimeout())
+		}
+		switch {
+		case err != nil:
+			log.Logger.Error(ctx, "tab failed health probe", err, nil)
+			reason = "unhealthy"
+		case p.lifecycle.MaxRenders > 0 && renders >= p.lifecycle.MaxRenders:
+			reason = "max renders"
+		case p.lifecycle.MaxHeapBytes > 0 && heapUsed > float64(p.lifecycle.MaxHeapBytes):
+			reason = "heap limit"
+		}
+	}
+
+	if reason == "" {
+		p.pool <- page
+		return
+	}
+
+	if broken || p.isolation != IsolationPerRequest {
+		log.Logger.Info(ctx, "replacing tab", map[string]any{"reason": reason, "renders": renders, "heapUsed": heapUsed})
+	}
+	go p.replace(page, state)
+}
+
+// replace discards page and puts a fresh tab in its place, retrying until
+// the browser can open one so the pool does not shrink.
+func (p *TabPool) replace(page *rod.Page, state *tabState) {
+	ctx := context.Background()
+	p.discard(ctx, page, state)
+
+	backoff := 100 * time.Millisecond
+	for !p.isClosed() {
+		fresh, err := p.newTab()
+		if err == nil {
+			p.pool <- fresh
+			return
+		}
+		log.Logger.Error(ctx, "failed to open replacement tab", err, map[string]any{"retryIn": backoff})
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxReplaceBackoff {
+			backoff = maxReplaceBackoff
+		}
+	}
+}
+
+func (p *TabPool) discard(ctx context.Context, page *rod.Page, state *tabState) {
+	p.mu.Lock()
+	delete(p.tabs, page)
+	p.mu.Unlock()
+	discardTab(ctx, page, state.context, p.lifecycle.probeTimeout())
+}
+
+// drain closes the idle tabs of a retired pool.
+func (p *TabPool) drain() {
+	ctx := context.Background()
+	for {
+		select {
+		case page := <-p.pool:
+			p.mu.Lock()
+			state := p.tabs[page]
+			p.mu.Unlock()
+			if state == nil {
+				state = &tabState{}
+			}
+			p.discard(ctx, page, state)
+		default:
+			return
+		}
+	}
+}
+
+func closeTab(ctx context.Context, page *rod.Page, timeout time.Duration) {
+	p := page.Timeout(timeout)
+	defer p.CancelTimeout()
+
+	if err := p.Close(); err != nil {
+		log.Logger.Error(ctx, "failed to close tab", err, nil)
+	}
+}
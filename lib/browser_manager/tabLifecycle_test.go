@@ -0,0 +1,91 @@
+package browser_manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/internal/cdptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTabPoolRecyclesTabs(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		lifecycle LifecycleConfig
+		heap      cdptest.Handler
+		// replacedAfter is the render after which the tab is replaced, 0
+		// if it is kept.
+		replacedAfter int
+	}{
+		{
+			name:      "healthy",
+			lifecycle: LifecycleConfig{},
+		},
+		{
+			name:      "unhealthy",
+			lifecycle: LifecycleConfig{ProbeTimeout: time.Second},
+			heap: func(cdptest.Call) (any, error) {
+				return nil, errors.New("renderer crashed")
+			},
+			replacedAfter: 1,
+		},
+		{
+			name:          "max_renders",
+			lifecycle:     LifecycleConfig{MaxRenders: 2},
+			replacedAfter: 2,
+		},
+		{
+			name:      "heap_limit",
+			lifecycle: LifecycleConfig{MaxHeapBytes: 1 << 20},
+			heap: func(cdptest.Call) (any, error) {
+				return map[string]any{"usedSize": 2 << 20, "totalSize": 4 << 20}, nil
+			},
+			replacedAfter: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser := cdptest.NewServer()
+			t.Cleanup(browser.Close)
+			if tt.heap != nil {
+				browser.Handle("Runtime.getHeapUsage", tt.heap)
+			}
+			m := newRemoteTestManager(t, browser, tt.lifecycle)
+
+			page, err := m.GetTab(ctx)
+			require.NoError(t, err)
+			first := browser.Target(string(page.SessionID))
+
+			for render := 1; render <= 3; render++ {
+				m.ReleaseTab(page)
+				if render == tt.replacedAfter {
+					break
+				}
+				// a kept tab is handed out again
+				page, err = m.GetTab(ctx)
+				require.NoError(t, err)
+				require.Equal(t, first, browser.Target(string(page.SessionID)))
+			}
+			if tt.replacedAfter == 0 {
+				m.ReleaseTab(page)
+				assert.False(t, browser.Targets()[first])
+				return
+			}
+
+			// the tab is closed and a fresh one takes its place
+			require.Eventually(t, func() bool {
+				return browser.Targets()[first] && m.Stats().Browsers[0].IdleTabs == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			fresh, err := m.GetTab(ctx)
+			require.NoError(t, err)
+			assert.NotEqual(t, first, browser.Target(string(fresh.SessionID)))
+			m.ReleaseTab(fresh)
+		})
+	}
+}
@@ -2,80 +2,116 @@ package browser_manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/Zomato/espresso/lib/logger"
 	"github.com/go-rod/rod"
 )
 
-// TabPool manages a pool of browser tabs using a channel.
+// TabPool manages a pool of tabs in one browser using a channel.
 type TabPool struct {
 	pool      chan *rod.Page
 	initOnce  sync.Once
 	totalTabs int
+	browser   *rod.Browser
+	lifecycle LifecycleConfig
+	isolation string
+	// generation is the generation of the browser the tabs belong to.
+	generation uint64
+
+	mu sync.Mutex
+	// tabs holds the state of every tab the pool owns, idle or handed out.
+	tabs map[*rod.Page]*tabState
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-var (
-	tabManagerInstance *TabPool
-	numTabs            int
-)
+type tabState struct {
+	// renders counts the renders served since the tab was opened, for
+	// recycling.
+	renders int
+	// context is the tab's own browser context, nil with shared isolation.
+	context *rod.Browser
+}
 
-func InitializeTabManager(ctx context.Context, tabPool int) {
-	tabManagerInstance = NewTabPool(ctx, Browser, tabPool)
+// QueueConfig bounds how callers wait for a tab when every pooled tab is busy.
+type QueueConfig struct {
+	// MaxQueueDepth is the number of callers allowed to wait for a tab at
+	// once. Further callers fail fast with an *OverloadedError. 0 means no
+	// limit.
+	MaxQueueDepth int
+	// AcquireTimeout caps how long a caller waits for a tab, on top of any
+	// deadline on its context. 0 means wait as long as the context allows.
+	AcquireTimeout time.Duration
 }
 
-func NewTabPool(ctx context.Context, browser *rod.Browser, tabPool int) *TabPool {
-	log.Logger.Info(ctx, "Initializing tab pool", map[string]any{"totalTabs": tabPool})
+// OverloadedError is returned by GetTab when a tab cannot be handed out
+// within the configured queue depth or acquire timeout. Callers should shed
+// the request rather than retry immediately.
+type OverloadedError struct {
+	// Waiting is the number of callers queued for a tab at the time.
+	Waiting int
+	Reason  string
+}
 
-	numTabs = tabPool
-	if tabPool == 0 {
-		return nil
-	}
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("browser overloaded: %s (%d waiting for a tab)", e.Reason, e.Waiting)
+}
+
+func NewTabPool(ctx context.Context, browser *rod.Browser, tabPool int, lifecycle LifecycleConfig, isolation string) (*TabPool, error) {
+	log.Logger.Info(ctx, "Initializing tab pool", map[string]any{"totalTabs": tabPool, "isolation": isolation})
 
 	pool := &TabPool{
 		pool:      make(chan *rod.Page, tabPool),
 		totalTabs: tabPool,
+		browser:   browser,
+		lifecycle: lifecycle,
+		isolation: isolation,
+		tabs:      make(map[*rod.Page]*tabState, tabPool),
+		closed:    make(chan struct{}),
 	}
 
+	var err error
 	pool.initOnce.Do(func() {
 		for i := 0; i < tabPool; i++ {
-			page := browser.MustPage("about:blank")
-			attachRequestFilter(page)
+			var page *rod.Page
+			if page, err = pool.newTab(); err != nil {
+				return
+			}
 			pool.pool <- page
 		}
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pooled tab: %w", err)
+	}
 
-	return pool
+	return pool, nil
 }
 
-// if the `browser.tabs` is 0 then we are creating a new tab on each request
-func GetTab() *rod.Page {
-	log.Logger.Info(context.Background(), "Getting tab", nil)
-	if numTabs == 0 {
-		page := Browser.MustPage("about:blank")
-		attachRequestFilter(page)
-		return page
-	}
+var errPoolClosed = errors.New("tab pool closed")
 
-	page := <-tabManagerInstance.pool
-	return page
+// idle is the number of tabs ready to be handed out.
+func (p *TabPool) idle() int {
+	return len(p.pool)
 }
 
-func ReleaseTab(page *rod.Page) {
-	log.Logger.Info(context.Background(), "Releasing Tab", nil)
-	if numTabs == 0 {
-		page.MustClose()
-		return
-	}
-	err := page.SetDocumentContent("")
-	if err != nil {
-		log.Logger.Error(context.Background(), "Error releasing tab", err, nil)
+// close retires the pool after the browser behind it was lost. Waiters move
+// to the replacement pool and tabs released into it are closed.
+func (p *TabPool) close() {
+	p.closeOnce.Do(func() { close(p.closed) })
+}
 
-		panic(err)
+func (p *TabPool) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
 	}
-
-	tabManagerInstance.pool <- page
 }
 
 func ClearAllBlobs(page *rod.Page, dynaminData map[string]interface{}) {
@@ -84,7 +120,6 @@ func ClearAllBlobs(page *rod.Page, dynaminData map[string]interface{}) {
 		if ok && strValue != "" {
 			if err := removeBlobURL(page, strValue); err != nil {
 				log.Logger.Error(context.Background(), "Error clearing blob URL", err, nil)
-				panic(err)
 			}
 		}
 	}
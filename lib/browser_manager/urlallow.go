@@ -1,41 +1,69 @@
 package browser_manager
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"path"
 	"regexp"
 	"strings"
-	"sync"
+	"sync/atomic"
 )
 
-var subdomainRegex = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+var subdomainRegex = regexp.MustCompile(`^[a-z0-9]+$`)
 
-var (
-	mu             sync.RWMutex
-	allowedDomains []string
-)
+var allowlist atomic.Pointer[Allowlist]
+
+type allowlistsKey struct{}
 
-// SetAllowedDomains replaces the allowlist. Safe for concurrent use with
-// IsURLAllowed so the embedder (typically the service) can push updates at
-// runtime — e.g. from a config hot-reload callback.
-func SetAllowedDomains(domains []string) {
-	mu.Lock()
-	defer mu.Unlock()
-	allowedDomains = append(allowedDomains[:0:0], domains...)
+// WithAllowlist returns a context whose renders may also fetch what list
+// allows, on top of the allowlist set with SetAllowedDomains. It can be
+// called more than once, e.g. for a template's list and a tenant's, and the
+// lists are combined: a URL is allowed if any list allows it and none
+// denies it.
+//
+// Tabs acquired with the context, and PrefetchImages, apply the combined
+// lists for the rest of the render.
+func WithAllowlist(ctx context.Context, list *Allowlist) context.Context {
+	if list == nil {
+		return ctx
+	}
+	lists, _ := ctx.Value(allowlistsKey{}).([]*Allowlist)
+	return context.WithValue(ctx, allowlistsKey{}, append(lists[:len(lists):len(lists)], list))
 }
 
-func getAllowedDomains() []string {
-	mu.RLock()
-	defer mu.RUnlock()
-	return allowedDomains
+func contextAllowlists(ctx context.Context) []*Allowlist {
+	lists, _ := ctx.Value(allowlistsKey{}).([]*Allowlist)
+	return lists
+}
+
+// SetAllowedDomains compiles rules and replaces the allowlist with them. Safe
+// for concurrent use with IsURLAllowed so the embedder (typically the service)
+// can push updates at runtime — e.g. from a config hot-reload callback. If a
+// rule is invalid the current allowlist is kept.
+func SetAllowedDomains(rules []string) error {
+	compiled, err := CompileAllowlist(rules)
+	if err != nil {
+		return err
+	}
+	allowlist.Store(compiled)
+	return nil
 }
 
-// IsURLAllowed reports whether the URL may be fetched during PDF generation.
-// Rules:
-//   - Only https:// URLs are eligible.
-//   - The host must exactly equal an allowlisted entry, or be a single-label
-//     alphanumeric subdomain of one (no dots or hyphens in the subdomain part).
+// IsURLAllowed reports whether the URL may be fetched during PDF generation
+// under the allowlist set with SetAllowedDomains. Only https:// URLs are
+// eligible.
 func IsURLAllowed(urlStr string) (bool, string) {
+	return isURLAllowed(urlStr, nil)
+}
+
+// IsURLAllowedContext is IsURLAllowed with the lists added to ctx with
+// WithAllowlist applied too.
+func IsURLAllowedContext(ctx context.Context, urlStr string) (bool, string) {
+	return isURLAllowed(urlStr, contextAllowlists(ctx))
+}
+
+func isURLAllowed(urlStr string, extra []*Allowlist) (bool, string) {
 	if !strings.HasPrefix(urlStr, "https://") {
 		return false, "URL does not start with https://"
 	}
@@ -44,24 +72,173 @@ func IsURLAllowed(urlStr string) (bool, string) {
 	if err != nil {
 		return false, fmt.Sprintf("invalid URL format: %v", err)
 	}
+	return allows(parsedURL, allowlist.Load(), extra...)
+}
+
+// Allowlist is a compiled set of allow and deny rules. Each rule is
+//
+//	[!]host[:port][/path/prefix]
+//
+// where host is one of
+//   - example.com: the host itself, or a single alphanumeric label below it
+//     such as cdn.example.com
+//   - *.example.com: exactly one label below it, e.g. assets-prod.example.com
+//   - **.example.com: any number of labels below it, e.g. a.b.example.com
+//
+// Without a port only the default https port matches. A path prefix matches
+// whole path segments, so /static matches /static and /static/a.png but not
+// /staticfiles. Paths are compared decoded and case-sensitively, after
+// removing dot segments, and a URL whose path hides them with %2e, %2f or
+// %5c matches no allow rule with a path and every deny rule with one. Rules
+// starting with ! deny what they match, and take precedence over every allow
+// rule.
+//
+// A nil Allowlist allows nothing.
+type Allowlist struct {
+	allow []hostRule
+	deny  []hostRule
+}
 
-	parsedHost := strings.ToLower(parsedURL.Host)
-	for _, domain := range getAllowedDomains() {
-		domain = strings.ToLower(domain)
-		if parsedHost == domain {
-			return true, ""
+type hostRule struct {
+	raw string
+	// host is the rule's host without its wildcard prefix.
+	host string
+	// labels is 0 for a plain host, 1 for *. and -1 for **.
+	labels int
+	port   string
+	path   string
+}
+
+// CompileAllowlist parses rules into an Allowlist. Hosts are matched
+// case-insensitively and empty rules are skipped.
+func CompileAllowlist(rules []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, raw := range rules {
+		rule := strings.TrimSpace(raw)
+		if rule == "" {
+			continue
+		}
+
+		deny := strings.HasPrefix(rule, "!")
+		compiled, err := compileRule(strings.TrimPrefix(rule, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist rule %q: %v", raw, err)
 		}
+		compiled.raw = raw
+
+		if deny {
+			a.deny = append(a.deny, compiled)
+		} else {
+			a.allow = append(a.allow, compiled)
+		}
+	}
+	return a, nil
+}
+
+func compileRule(rule string) (hostRule, error) {
+	if strings.Contains(rule, "://") {
+		return hostRule{}, fmt.Errorf("rules have no scheme, only https is ever allowed")
+	}
+
+	u, err := url.Parse("https://" + rule)
+	if err != nil {
+		return hostRule{}, err
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return hostRule{}, fmt.Errorf("rules cannot have credentials, a query or a fragment")
+	}
+
+	r := hostRule{host: strings.ToLower(u.Hostname()), port: u.Port(), path: strings.TrimSuffix(u.Path, "/")}
+	switch {
+	case strings.HasPrefix(r.host, "**."):
+		r.host, r.labels = r.host[len("**."):], -1
+	case strings.HasPrefix(r.host, "*."):
+		r.host, r.labels = r.host[len("*."):], 1
+	}
+	if r.host == "" || strings.Contains(r.host, "*") {
+		return hostRule{}, fmt.Errorf("wildcards are only allowed as a leading *. or **.")
+	}
+	return r, nil
+}
+
+// Allows reports whether u matches an allow rule and no deny rule, and if
+// not, why.
+func (a *Allowlist) Allows(u *url.URL) (bool, string) {
+	return allows(u, a)
+}
 
-		if strings.HasSuffix(parsedHost, "."+domain) {
-			subdomainPart := strings.TrimSuffix(parsedHost, "."+domain)
-			if subdomainPart != "" &&
-				!strings.Contains(subdomainPart, ".") &&
-				!strings.Contains(subdomainPart, "-") &&
-				subdomainRegex.MatchString(subdomainPart) {
+// allows applies lists as if they were one. Nil lists are skipped.
+func allows(u *url.URL, first *Allowlist, rest ...*Allowlist) (bool, string) {
+	lists := append([]*Allowlist{first}, rest...)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	path, ambiguous := cleanURLPath(u)
+	for _, a := range lists {
+		if a == nil {
+			continue
+		}
+		for _, r := range a.deny {
+			if r.matchesHost(host, port) && (r.path == "" || ambiguous || r.matchesPath(path)) {
+				return false, fmt.Sprintf("denied by allowlist rule %q", r.raw)
+			}
+		}
+	}
+	for _, a := range lists {
+		if a == nil {
+			continue
+		}
+		for _, r := range a.allow {
+			if r.matchesHost(host, port) && (r.path == "" || !ambiguous && r.matchesPath(path)) {
 				return true, ""
 			}
 		}
 	}
+	return false, fmt.Sprintf("domain not in whitelist: %s", u.Host)
+}
 
-	return false, fmt.Sprintf("domain not in whitelist: %s", parsedURL.Host)
+// cleanURLPath returns the decoded path of u without dot segments, the path
+// servers resolve it to. It reports the path as ambiguous when it encodes
+// dots, slashes or backslashes, or has a backslash, since servers differ in
+// whether they decode or split on those before resolving.
+func cleanURLPath(u *url.URL) (string, bool) {
+	lower := strings.ToLower(u.EscapedPath())
+	if strings.Contains(lower, "%2e") || strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") || strings.Contains(u.Path, "\\") {
+		return "", true
+	}
+	if u.Path == "" {
+		return "/", false
+	}
+	return path.Clean(u.Path), false
+}
+
+func (r hostRule) matchesHost(host, port string) bool {
+	if !r.matchesHostname(host) {
+		return false
+	}
+	if r.port == "" {
+		return port == "" || port == "443"
+	}
+	return port == r.port
+}
+
+func (r hostRule) matchesPath(path string) bool {
+	return path == r.path || strings.HasPrefix(path, r.path+"/")
+}
+
+func (r hostRule) matchesHostname(host string) bool {
+	if host == r.host {
+		// *. and **. only match below the host
+		return r.labels == 0
+	}
+
+	sub, ok := strings.CutSuffix(host, "."+r.host)
+	if !ok || sub == "" {
+		return false
+	}
+	switch r.labels {
+	case 0:
+		return subdomainRegex.MatchString(sub)
+	case 1:
+		return !strings.Contains(sub, ".")
+	}
+	return true
 }
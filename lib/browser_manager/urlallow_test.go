@@ -0,0 +1,116 @@
+package browser_manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsURLAllowed(t *testing.T) {
+	err := SetAllowedDomains([]string{
+		"Example.com",
+		"*.one.test",
+		"**.any.test",
+		"ports.test:8443",
+		"paths.test/static/",
+		"**.cdn.test",
+		"!private.cdn.test",
+		"!cdn.test/secret",
+		"CASES.test/Static",
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { SetAllowedDomains(nil) })
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/a.png", true},
+		{"https://EXAMPLE.com:443/a.png", true},
+		{"https://cdn.example.com/a.png", true},
+		{"https://cdn-1.example.com/a.png", false},
+		{"https://a.b.example.com/a.png", false},
+		{"http://example.com/a.png", false},
+
+		{"https://assets-prod.one.test/a.png", true},
+		{"https://one.test/a.png", false},
+		{"https://a.b.one.test/a.png", false},
+
+		{"https://assets-prod.cdn.any.test/a.png", true},
+		{"https://any.test/a.png", false},
+
+		{"https://ports.test:8443/a.png", true},
+		{"https://ports.test/a.png", false},
+		{"https://example.com:8443/a.png", false},
+
+		{"https://paths.test/static", true},
+		{"https://paths.test/static/img/a.png", true},
+		{"https://paths.test/staticfiles/a.png", false},
+		{"https://paths.test/a.png", false},
+		{"https://paths.test/static/../private/a.png", false},
+		{"https://paths.test/static/%2e%2e/private/a.png", false},
+		{"https://paths.test/static/..%2Fprivate/a.png", false},
+		{"https://paths.test/static/./img/../a.png", true},
+		{"https://paths.test/%73tatic/a.png", true},
+		{"https://paths.test/Static/a.png", false},
+		{"https://cases.test/Static/a.png", true},
+		{"https://cases.test/static/a.png", false},
+
+		{"https://img.cdn.test/a.png", true},
+		{"https://private.cdn.test/a.png", false},
+		{"https://cdn.test/secret/a.png", false},
+		{"https://img-1.cdn.test/secret/a.png", true},
+		{"https://cdn.test/public/../secret/a.png", false},
+		{"https://cdn.test/%73ecret/a.png", false},
+		{"https://cdn.test/public\\..\\secret/a.png", false},
+		{"https://cdn.test/public/%2e%2e/secret/a.png", false},
+		{"https://evil.test/?u=https://example.com", false},
+	}
+	for _, tt := range tests {
+		allowed, reason := IsURLAllowed(tt.url)
+		assert.Equal(t, tt.allowed, allowed, "%s: %s", tt.url, reason)
+	}
+}
+
+func TestCompileAllowlistRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []string{"https://example.com", "a.*.example.com", "*", "example.com/?q=1", "user@example.com"} {
+		_, err := CompileAllowlist([]string{rule})
+		assert.Error(t, err, rule)
+	}
+
+	assert.NoError(t, SetAllowedDomains([]string{"example.com"}))
+	t.Cleanup(func() { SetAllowedDomains(nil) })
+	assert.Error(t, SetAllowedDomains([]string{"example.com", "a.*.test"}))
+	allowed, _ := IsURLAllowed("https://example.com/a.png")
+	assert.True(t, allowed, "invalid rules keep the current allowlist")
+}
+
+func TestIsURLAllowedContext(t *testing.T) {
+	assert.NoError(t, SetAllowedDomains([]string{"**.shared.test"}))
+	t.Cleanup(func() { SetAllowedDomains(nil) })
+
+	marketing, err := CompileAllowlist([]string{"**.marketing-cdn.test"})
+	assert.NoError(t, err)
+	tenant, err := CompileAllowlist([]string{"!private.shared.test"})
+	assert.NoError(t, err)
+
+	ctx := WithAllowlist(context.Background(), marketing)
+	ctx = WithAllowlist(ctx, tenant)
+
+	tests := []struct {
+		ctx     context.Context
+		url     string
+		allowed bool
+	}{
+		{context.Background(), "https://img.marketing-cdn.test/a.png", false},
+		{ctx, "https://img.marketing-cdn.test/a.png", true},
+		{ctx, "https://img.shared.test/a.png", true},
+		{context.Background(), "https://private.shared.test/a.png", true},
+		{ctx, "https://private.shared.test/a.png", false},
+	}
+	for _, tt := range tests {
+		allowed, reason := IsURLAllowedContext(tt.ctx, tt.url)
+		assert.Equal(t, tt.allowed, allowed, "%s: %s", tt.url, reason)
+	}
+}
@@ -0,0 +1,338 @@
+// Package cdptest runs a fake browser behind a DevTools websocket endpoint,
+// so the browser manager and the renderer can be tested without Chrome. It
+// answers the calls rod makes to open, probe and close tabs, and every other
+// method with an empty result unless told otherwise.
+package cdptest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Call is a DevTools method call received by the browser.
+type Call struct {
+	SessionID string
+	Method    string
+	Params    json.RawMessage
+}
+
+// Handler answers a call with its result, or fails it.
+type Handler func(call Call) (any, error)
+
+// Server is a fake browser. Connections to it share its targets.
+type Server struct {
+	// URL is the browser's websocket endpoint, e.g. for
+	// browser_manager.RemoteConfig.URLs.
+	URL string
+
+	http *httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	hung     map[string]bool
+	calls    []Call
+	conns    map[*conn]bool
+	refuse   bool
+	next     int
+	sessions map[string]string // session ID to target ID
+	closed   map[string]bool   // closed target IDs
+}
+
+// NewServer starts a fake browser. Close stops it.
+func NewServer() *Server {
+	s := &Server{
+		handlers: map[string]Handler{},
+		hung:     map[string]bool{},
+		conns:    map[*conn]bool{},
+		sessions: map[string]string{},
+		closed:   map[string]bool{},
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveWebSocket))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/devtools/browser/cdptest"
+	return s
+}
+
+// Close drops every connection and stops the server.
+func (s *Server) Close() {
+	s.Disconnect()
+	s.http.Close()
+}
+
+// Handle answers method with h instead of the default result.
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Hang stops the browser answering method, as a busy or hung tab would.
+// Calls already made stay unanswered.
+func (s *Server) Hang(method string, hang bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hung[method] = hang
+}
+
+// Refuse makes new connections fail their handshake, as a browser that is
+// down would.
+func (s *Server) Refuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// Disconnect drops every connection, as a crashed browser would.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = map[*conn]bool{}
+	s.mu.Unlock()
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// Calls returns the calls made to method so far.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Targets returns the IDs of the targets opened so far, and whether each has
+// been closed since.
+func (s *Server) Targets() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	targets := map[string]bool{}
+	for _, target := range s.sessions {
+		targets[target] = s.closed[target]
+	}
+	return targets
+}
+
+// Target returns the ID of the target a session is attached to.
+func (s *Server) Target(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sessionID]
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	refuse := s.refuse
+	s.mu.Unlock()
+	if refuse || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "browser unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	accept := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return
+	}
+
+	c := &conn{Conn: netConn, r: rw.Reader}
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID        int             `json:"id"`
+			SessionID string          `json:"sessionId"`
+			Method    string          `json:"method"`
+			Params    json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		s.call(c, req.ID, Call{SessionID: req.SessionID, Method: req.Method, Params: req.Params})
+	}
+}
+
+// call answers a call on c, then sends the events it causes.
+func (s *Server) call(c *conn, id int, call Call) {
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	hung, handler := s.hung[call.Method], s.handlers[call.Method]
+	s.mu.Unlock()
+	if hung {
+		return
+	}
+
+	var result any
+	var err error
+	var events []any
+	if handler != nil {
+		result, err = handler(call)
+	} else {
+		result, events = s.answer(call)
+	}
+
+	resp := map[string]any{"id": id}
+	if call.SessionID != "" {
+		resp["sessionId"] = call.SessionID
+	}
+	if err != nil {
+		resp["error"] = map[string]any{"code": -32000, "message": err.Error()}
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		resp["result"] = result
+	}
+	c.send(resp)
+	for _, event := range events {
+		c.send(event)
+	}
+}
+
+// answer is the default result of a call.
+func (s *Server) answer(call Call) (any, []any) {
+	var params struct {
+		TargetID string `json:"targetId"`
+	}
+	_ = json.Unmarshal(call.Params, &params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch call.Method {
+	case "Browser.getVersion":
+		return map[string]any{"protocolVersion": "1.3", "product": "cdptest"}, nil
+	case "Target.createBrowserContext":
+		s.next++
+		return map[string]any{"browserContextId": fmt.Sprintf("context-%d", s.next)}, nil
+	case "Target.createTarget":
+		s.next++
+		return map[string]any{"targetId": fmt.Sprintf("target-%d", s.next)}, nil
+	case "Target.attachToTarget":
+		s.next++
+		session := fmt.Sprintf("session-%d", s.next)
+		s.sessions[session] = params.TargetID
+		return map[string]any{"sessionId": session}, nil
+	case "Target.closeTarget":
+		s.closed[params.TargetID] = true
+		return map[string]any{"success": true}, []any{targetDestroyed(params.TargetID)}
+	case "Page.close":
+		target := s.sessions[call.SessionID]
+		s.closed[target] = true
+		return nil, []any{targetDestroyed(target)}
+	case "Runtime.getHeapUsage":
+		return map[string]any{"usedSize": 0, "totalSize": 0}, nil
+	}
+	return nil, nil
+}
+
+func targetDestroyed(targetID string) any {
+	return map[string]any{"method": "Target.targetDestroyed", "params": map[string]any{"targetId": targetID}}
+}
+
+// conn is one websocket connection. Clients mask their frames, the server
+// does not.
+type conn struct {
+	net.Conn
+	r  *bufio.Reader
+	mu sync.Mutex
+}
+
+func (c *conn) read() ([]byte, error) {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		opcode := header[0] & 0x0f
+		size := uint64(header[1] & 0x7f)
+		switch size {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return nil, err
+			}
+			size = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return nil, err
+			}
+			size = binary.BigEndian.Uint64(ext[:])
+		}
+		var mask [4]byte
+		if header[1]&0x80 != 0 {
+			if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case 0x1:
+			return payload, nil
+		case 0x8:
+			return nil, errors.New("connection closed by the client")
+		}
+	}
+}
+
+func (c *conn) send(v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	header := []byte{0x81, 0}
+	switch {
+	case len(payload) <= 125:
+		header[1] = byte(len(payload))
+	case len(payload) < 1<<16:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Write(append(header, payload...))
+}
@@ -0,0 +1,86 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+)
+
+// AssetScheme is the scheme templates reference their assets with, e.g.
+// espresso-asset://<template-id>/css/invoice.css. The host is the template's
+// UUID, or self for whichever template is being rendered.
+const AssetScheme = "espresso-asset"
+
+var (
+	assetURLRegex = regexp.MustCompile(AssetScheme + `://([^/"'()\s]+)/`)
+	baseTagRegex  = regexp.MustCompile(`(?i)<base[\s>]`)
+	headTagRegex  = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	doctypeRegex  = regexp.MustCompile(`(?i)^\s*<!doctype[^>]*>`)
+)
+
+// templateAssets returns the AssetFunc serving the assets stored next to the
+// requested template, or nil if the store keeps no assets or the template
+// does not come from the store.
+func templateAssets(store templatestore.StorageAdapter, req templatestore.GetTemplateRequest) browser_manager.AssetFunc {
+	assets, ok := store.(templatestore.AssetStore)
+	if !ok || (req.TemplateUUID == "" && req.TemplatePath == "" && req.TemplateS3Path == "") {
+		return nil
+	}
+	req.TemplateBytes = nil
+
+	return func(ctx context.Context, path string) ([]byte, string, error) {
+		asset, err := assets.GetAsset(ctx, &templatestore.GetAssetRequest{Template: req, Path: path})
+		if err != nil {
+			if errors.Is(err, templatestore.ErrAssetNotFound) {
+				return nil, "", browser_manager.ErrAssetNotFound
+			}
+			return nil, "", err
+		}
+		content := asset.Content
+		if strings.HasPrefix(asset.ContentType, "text/css") {
+			content = []byte(rewriteAssetURLs(string(content), req.TemplateUUID))
+		}
+		return content, asset.ContentType, nil
+	}
+}
+
+// rewriteAssetURLs points the espresso-asset:// URLs of the template with
+// templateID at browser_manager.AssetOrigin. URLs of other templates are left
+// alone, and blocked by the request filter.
+func rewriteAssetURLs(content, templateID string) string {
+	return assetURLRegex.ReplaceAllStringFunc(content, func(match string) string {
+		id := assetURLRegex.FindStringSubmatch(match)[1]
+		if id != "self" && (templateID == "" || id != templateID) {
+			return match
+		}
+		return browser_manager.AssetOrigin + "/"
+	})
+}
+
+// withAssetBase rewrites the asset URLs of htmlContent and resolves its
+// relative URLs against browser_manager.AssetOrigin, unless the template
+// sets its own <base>.
+func withAssetBase(htmlContent, templateID string) string {
+	htmlContent = rewriteAssetURLs(htmlContent, templateID)
+	if baseTagRegex.MatchString(htmlContent) {
+		return htmlContent
+	}
+
+	return insertIntoHead(htmlContent, `<base href="`+browser_manager.AssetOrigin+`/">`)
+}
+
+// insertIntoHead inserts snippet at the start of the head of htmlContent.
+func insertIntoHead(htmlContent, snippet string) string {
+	if loc := headTagRegex.FindStringIndex(htmlContent); loc != nil {
+		return htmlContent[:loc[1]] + snippet + htmlContent[loc[1]:]
+	}
+	// anything before the doctype would switch the page to quirks mode
+	if loc := doctypeRegex.FindStringIndex(htmlContent); loc != nil {
+		return htmlContent[:loc[1]] + snippet + htmlContent[loc[1]:]
+	}
+	return snippet + htmlContent
+}
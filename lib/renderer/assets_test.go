@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAssetBase(t *testing.T) {
+	html := withAssetBase(`<!DOCTYPE html><html><head><link href="espresso-asset://self/a.css"></head>`+
+		`<img src="espresso-asset://tpl-1/logo.png"><img src="espresso-asset://tpl-2/logo.png"></html>`, "tpl-1")
+	assert.Equal(t, `<!DOCTYPE html><html><head><base href="https://assets.espresso.invalid/">`+
+		`<link href="https://assets.espresso.invalid/a.css"></head>`+
+		`<img src="https://assets.espresso.invalid/logo.png"><img src="espresso-asset://tpl-2/logo.png"></html>`, html)
+
+	assert.Equal(t, `<!doctype html><base href="https://assets.espresso.invalid/"><p>`, withAssetBase(`<!doctype html><p>`, ""))
+
+	own := `<head><base href="https://cdn.example.com/"></head>`
+	assert.Equal(t, own, withAssetBase(own, ""))
+}
+
+func TestTemplateAssets(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "assets", "css"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "css", "a.css"), []byte(`@font-face{src:url(espresso-asset://self/f.woff2)}`), 0644))
+
+	var store templatestore.StorageAdapter = &templatestore.DiskTemplateStorage{}
+	assets := templateAssets(store, templatestore.GetTemplateRequest{TemplatePath: filepath.Join(dir, "invoice.html")})
+
+	content, contentType, err := assets(context.Background(), "css/a.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/css; charset=utf-8", contentType)
+	assert.Equal(t, `@font-face{src:url(https://assets.espresso.invalid/f.woff2)}`, string(content))
+
+	_, _, err = assets(context.Background(), "missing.png")
+	assert.ErrorIs(t, err, browser_manager.ErrAssetNotFound)
+
+	_, _, err = assets(context.Background(), "../secret")
+	assert.ErrorContains(t, err, "escapes the template directory")
+
+	assert.Nil(t, templateAssets(&templatestore.StreamStorage{}, templatestore.GetTemplateRequest{TemplateBytes: []byte("x")}))
+}
@@ -1,15 +1,72 @@
 package renderer
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/Zomato/espresso/lib/browser_manager"
 	"github.com/Zomato/espresso/lib/templatestore"
 	"github.com/go-rod/rod/lib/proto"
 )
 
 type GetHtmlPdfInput struct {
+	Browser         *browser_manager.Manager
 	TemplateRequest templatestore.GetTemplateRequest
 	Data            []byte
 	ViewPort        *browser_manager.ViewportConfig
 	PdfParams       *proto.PagePrintToPDF
 	IsSinglePage    bool
+	// Wait overrides the waits set by the template's espresso-wait meta tag.
+	Wait *WaitOptions
+	// Images overrides how prefetched images are shrunk, as set by the
+	// template's espresso-images meta tag.
+	Images *ImageOptions
+	// ImageStores, if set, inline store:// and s3:// images in the data.
+	ImageStores *ImageStores
+	// ImagePolicy decides what happens to images that cannot be inlined.
+	ImagePolicy ImagePolicy
+	// Allowlists are combined with the global allowlist for this render, e.g.
+	// the template's and the tenant's. See browser_manager.WithAllowlist.
+	Allowlists []*browser_manager.Allowlist
+	// RenderTimeout bounds the render once a tab is acquired, waits and
+	// printing included. Defaults to DefaultRenderTimeout.
+	RenderTimeout time.Duration
+	// Fonts are declared with @font-face in every render and served from the
+	// registry.
+	Fonts *FontRegistry
+	// Report, if set, is filled in with what the render used.
+	Report *RenderReport
+}
+
+// RenderReport describes what a render used.
+type RenderReport struct {
+	// FontsUsed are the faces of GetHtmlPdfInput.Fonts Chrome fetched, which
+	// are the ones embedded in the PDF.
+	FontsUsed []Font
+	// Images reports every URL found in the data and what became of it. It
+	// is filled in before the render starts, so a render failed by a strict
+	// ImagePolicy reports it too.
+	Images []ImageResult
+}
+
+// DefaultRenderTimeout bounds a render when GetHtmlPdfInput.RenderTimeout is
+// not set.
+const DefaultRenderTimeout = 30 * time.Second
+
+// RenderTimeoutError is returned when a render does not finish within its
+// RenderTimeout. The tab it ran in is discarded.
+type RenderTimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *RenderTimeoutError) Error() string {
+	return fmt.Sprintf("render timed out after %s: %v", e.Timeout, e.Err)
+}
+
+// Unwrap lets errors.Is match context.DeadlineExceeded, and errors.Is and
+// errors.As reach the error the render failed with.
+func (e *RenderTimeoutError) Unwrap() []error {
+	return []error{context.DeadlineExceeded, e.Err}
 }
@@ -0,0 +1,240 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+)
+
+// Escaping modes of a template. Templates are executed with text/template,
+// which writes values as they are, unless they opt in to html/template's
+// context-aware escaping with a meta tag:
+//
+//	<meta name="espresso-escaping" content="html">
+//
+// In html mode a customer name of <script> in the data is printed as text
+// instead of running. Values that are meant to be markup are passed through
+// safeHTML, safeURL, safeCSS or safeJS, and images inlined by the prefetch
+// are trusted as they are.
+const (
+	EscapingText = "text"
+	EscapingHTML = "html"
+)
+
+var escapingMetaPattern = regexp.MustCompile(`(?is)<meta\s+name=["']espresso-escaping["']\s+content=(?:"([^"]*)"|'([^']*)')`)
+
+// TemplateEscaping returns the escaping mode a template asks for with its
+// espresso-escaping meta tag, EscapingText without one.
+func TemplateEscaping(tmpl *template.Template) (string, error) {
+	var source string
+	if tmpl != nil && tmpl.Tree != nil {
+		source = tmpl.Tree.Root.String()
+	}
+	match := escapingMetaPattern.FindStringSubmatch(source)
+	if match == nil {
+		return EscapingText, nil
+	}
+	switch mode := strings.TrimSpace(html.UnescapeString(match[1] + match[2])); mode {
+	case EscapingText, EscapingHTML:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid espresso-escaping meta tag: unknown mode %q", mode)
+	}
+}
+
+// executor is a parsed template in either escaping mode.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// htmlTemplate turns a template parsed by a store into one executed with
+// html escaping. Escaping rewrites the parse trees, so they are copied.
+func htmlTemplate(tmpl *template.Template) (*htmltemplate.Template, error) {
+	h := htmltemplate.New(tmpl.Name()).Funcs(htmltemplate.FuncMap(templatestore.Funcs()))
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if _, err := h.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+			return nil, fmt.Errorf("unable to use template %s with html escaping: %v", t.Name(), err)
+		}
+	}
+	// AddParseTree replaces h in its set by a template holding the tree
+	if root := h.Lookup(tmpl.Name()); root != nil {
+		return root, nil
+	}
+	return h, nil
+}
+
+// EscapingIssue is a construct that behaves differently once a template is
+// switched to html escaping.
+type EscapingIssue struct {
+	// Location is template:line:column.
+	Location string
+	// Action is the action as written, e.g. {{.customer.name}}, if the
+	// issue is about one.
+	Action  string
+	Message string
+}
+
+// escaperMessages explain what the escapers html/template adds to an action
+// change, by the context they are added for. Values escaped as HTML text or
+// attributes are not reported: that is the point of the switch, and markup
+// meant to be kept is found by reviewing the values, not the template.
+var escaperMessages = map[string]string{
+	"_html_template_jsvalescaper":     "in a script or event handler the value is written as a JavaScript value, so strings gain quotes",
+	"_html_template_jsstrescaper":     "in a JavaScript string quotes, backslashes and markup in the value are escaped",
+	"_html_template_jstmpllitescaper": "in a JavaScript template literal the value is escaped",
+	"_html_template_jsregexpescaper":  "in a JavaScript regular expression the value is escaped",
+	"_html_template_cssvaluefilter":   "in CSS values other than plain CSS tokens become ZgotmplZ",
+	"_html_template_cssescaper":       "in a CSS string or url() the value is CSS-escaped",
+	"_html_template_urlfilter":        "in a URL attribute URLs other than http, https and mailto become #ZgotmplZ, except images inlined by the prefetch",
+	"_html_template_htmlnamefilter":   "as an element or attribute name only plain names are allowed, others become ZgotmplZ",
+	"_html_template_commentescaper":   "HTML comments are removed, so the value is not written",
+}
+
+// trustedFuncs are the template functions whose results an escaper leaves
+// as they are, so actions ending in them are not reported for it.
+var trustedFuncs = map[string]string{
+	"safeJS":  "_html_template_jsvalescaper",
+	"toJSON":  "_html_template_jsvalescaper",
+	"safeURL": "_html_template_urlfilter",
+	"safeCSS": "_html_template_cssvaluefilter",
+}
+
+// LintEscaping reports the constructs of a template, parsed by a store or
+// with templatestore.Funcs, that would behave differently with html
+// escaping. A template that cannot be escaped at all, e.g. because an
+// action sits where its context is ambiguous, is reported as a single
+// issue.
+func LintEscaping(tmpl *template.Template) ([]EscapingIssue, error) {
+	if tmpl == nil {
+		return nil, fmt.Errorf("template is nil")
+	}
+	h, err := htmlTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []EscapingIssue
+	seen := map[EscapingIssue]bool{}
+	add := func(issue EscapingIssue) {
+		if !seen[issue] {
+			seen[issue] = true
+			issues = append(issues, issue)
+		}
+	}
+
+	// escaping strips comments from the text, so they are looked for first
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		tree := t.Tree
+		walkTemplate(tree.Root, func(node parse.Node) {
+			if text, ok := node.(*parse.TextNode); ok && strings.Contains(string(text.Text), "<!--") {
+				location, _ := tree.ErrorContext(node)
+				add(EscapingIssue{Location: location, Message: "HTML comments are removed"})
+			}
+		})
+	}
+
+	// escaping happens before the first execution, which stops at its
+	// first write
+	var escapeErr *htmltemplate.Error
+	if err := h.Execute(failingWriter{}, nil); errors.As(err, &escapeErr) {
+		location := escapeErr.Name
+		if escapeErr.Line > 0 {
+			location = fmt.Sprintf("%s:%d", escapeErr.Name, escapeErr.Line)
+		}
+		add(EscapingIssue{Location: location, Message: "cannot be escaped as HTML: " + escapeErr.Description})
+		return issues, nil
+	}
+
+	for _, t := range h.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		tree := t.Tree
+		walkTemplate(tree.Root, func(node parse.Node) {
+			action, ok := node.(*parse.ActionNode)
+			if !ok {
+				return
+			}
+			location, _ := tree.ErrorContext(node)
+			written, producer, escapers := splitEscapers(action.Pipe)
+			for _, escaper := range escapers {
+				if trustedFuncs[producer] == escaper {
+					continue
+				}
+				if message, ok := escaperMessages[escaper]; ok {
+					add(EscapingIssue{Location: location, Action: written, Message: message})
+				}
+			}
+		})
+	}
+	return issues, nil
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("not executed")
+}
+
+// splitEscapers returns an escaped pipeline as it was written, the function
+// its last written command calls, if any, and the escapers html/template
+// appended to it.
+func splitEscapers(pipe *parse.PipeNode) (string, string, []string) {
+	var escapers []string
+	var producer string
+	written := *pipe
+	written.Cmds = nil
+	for _, cmd := range pipe.Cmds {
+		var ident *parse.IdentifierNode
+		if len(cmd.Args) > 0 {
+			ident, _ = cmd.Args[0].(*parse.IdentifierNode)
+		}
+		if ident != nil && strings.HasPrefix(ident.Ident, "_html_template_") {
+			escapers = append(escapers, ident.Ident)
+			continue
+		}
+		producer = ""
+		if ident != nil {
+			producer = ident.Ident
+		}
+		written.Cmds = append(written.Cmds, cmd)
+	}
+	return "{{" + written.String() + "}}", producer, escapers
+}
+
+// walkTemplate calls fn for every node of list.
+func walkTemplate(list *parse.ListNode, fn func(parse.Node)) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		fn(node)
+		switch n := node.(type) {
+		case *parse.ListNode:
+			walkTemplate(n, fn)
+		case *parse.IfNode:
+			walkTemplate(n.List, fn)
+			walkTemplate(n.ElseList, fn)
+		case *parse.RangeNode:
+			walkTemplate(n.List, fn)
+			walkTemplate(n.ElseList, fn)
+		case *parse.WithNode:
+			walkTemplate(n.List, fn)
+			walkTemplate(n.ElseList, fn)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"testing"
+	"text/template"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTestTemplate(t *testing.T, source string) *template.Template {
+	tmpl, err := template.New("invoice").Funcs(templatestore.Funcs()).Parse(source)
+	require.NoError(t, err)
+	return tmpl
+}
+
+func TestHTMLEscaping(t *testing.T) {
+	source := `<meta name="espresso-escaping" content="html"><p>{{.name}}</p><img src="{{.photo}}"><img src="{{.other}}"><div>{{safeHTML .bio}}</div>`
+	tmpl := parseTestTemplate(t, source)
+	data := map[string]interface{}{
+		"name":  "<script>alert(1)</script>",
+		"photo": htmltemplate.URL("data:image/png;base64,AAAA"),
+		"other": "data:image/png;base64,BBBB",
+		"bio":   "<b>hi</b>",
+	}
+
+	escaping, err := TemplateEscaping(tmpl)
+	require.NoError(t, err)
+	require.Equal(t, EscapingHTML, escaping)
+	h, err := htmlTemplate(tmpl)
+	require.NoError(t, err)
+	out, err := executeTemplate(context.Background(), h, data)
+	require.NoError(t, err)
+	assert.Contains(t, out, "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>")
+	assert.Contains(t, out, `<img src="data:image/png;base64,AAAA">`)
+	assert.Contains(t, out, `<img src="#ZgotmplZ">`)
+	assert.Contains(t, out, "<div><b>hi</b></div>")
+
+	// the store's template is untouched and still writes values as they are
+	out, err = ExecuteTemplate(context.Background(), tmpl, data)
+	require.NoError(t, err)
+	assert.Contains(t, out, "<p><script>alert(1)</script></p>")
+
+	escaping, err = TemplateEscaping(parseTestTemplate(t, `<p>{{.name}}</p>`))
+	require.NoError(t, err)
+	assert.Equal(t, EscapingText, escaping)
+	_, err = TemplateEscaping(parseTestTemplate(t, `<meta name="espresso-escaping" content="xml">`))
+	assert.ErrorContains(t, err, `unknown mode "xml"`)
+}
+
+func TestLintEscaping(t *testing.T) {
+	tmpl := parseTestTemplate(t, "<!-- totals -->\n<script>var name = {{.name}};</script>\n<a href=\"{{.link}}\">{{.label}}</a><p>{{.plain | printf \"%s\"}}</p><script>var items = {{toJSON .items}};</script>")
+	issues, err := LintEscaping(tmpl)
+	require.NoError(t, err)
+	assert.Equal(t, []EscapingIssue{
+		{Location: "invoice:1:0", Message: "HTML comments are removed"},
+		{Location: "invoice:2:21", Action: "{{.name}}", Message: escaperMessages["_html_template_jsvalescaper"]},
+		{Location: "invoice:3:11", Action: "{{.link}}", Message: escaperMessages["_html_template_urlfilter"]},
+	}, issues)
+
+	issues, err = LintEscaping(parseTestTemplate(t, `{{if .x}}<a href="{{else}}<p>{{end}}`))
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0].Message, "cannot be escaped as HTML")
+}
@@ -0,0 +1,300 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+)
+
+// fontAssetPrefix is where fonts are served under browser_manager.AssetOrigin.
+// Template asset paths cannot start with it.
+const fontAssetPrefix = "_espresso/fonts/"
+
+const fontIndexFile = "index.json"
+
+var (
+	fontFamilyRegex = regexp.MustCompile(`^[A-Za-z0-9 _-]+$`)
+	fontWeightRegex = regexp.MustCompile(`^[1-9]00( [1-9]00)?$`)
+)
+
+// fontFormats maps the formats fonts can be uploaded in to their extension,
+// keyed by the format name used in @font-face src.
+var fontFormats = map[string]struct {
+	magic []byte
+	ext   string
+	mime  string
+}{
+	"truetype": {[]byte{0x00, 0x01, 0x00, 0x00}, ".ttf", "font/ttf"},
+	"opentype": {[]byte("OTTO"), ".otf", "font/otf"},
+	"woff2":    {[]byte("wOF2"), ".woff2", "font/woff2"},
+}
+
+// ErrInvalidFont is returned by FontRegistry.Add for fonts it does not accept.
+var ErrInvalidFont = errors.New("invalid font")
+
+// Font is a font face in a FontRegistry.
+type Font struct {
+	ID     string `json:"id"`
+	Family string `json:"family"`
+	// Weight is a CSS font-weight such as 400, or a range such as "100 900"
+	// for variable fonts.
+	Weight string `json:"weight"`
+	Style  string `json:"style"`
+	Format string `json:"format"`
+	Size   int    `json:"size"`
+}
+
+func (f *Font) path() string {
+	return f.ID + fontFormats[f.Format].ext
+}
+
+// AddFontRequest describes a font face to add to a FontRegistry.
+type AddFontRequest struct {
+	Family string
+	// Weight defaults to 400.
+	Weight string
+	// Style is normal or italic, and defaults to normal.
+	Style   string
+	Content []byte
+}
+
+// FontRegistry keeps the fonts uploaded for templates in a file store (disk
+// or S3) under a path prefix, with an index of their faces next to them.
+//
+// Renders given a FontRegistry get an @font-face rule for every face, so
+// templates only have to name the family in their CSS. Chrome fetches just
+// the faces a page uses, and the render's RenderReport lists them.
+type FontRegistry struct {
+	store  templatestore.StorageAdapter
+	prefix string
+
+	mu    sync.RWMutex
+	fonts []*Font
+	// content caches the fonts read from the store by ID
+	content map[string][]byte
+}
+
+// NewFontRegistry loads the registry kept in store under prefix, e.g.
+// "fonts/". The store is empty the first time.
+func NewFontRegistry(ctx context.Context, store templatestore.StorageAdapter, prefix string) (*FontRegistry, error) {
+	if _, ok := store.(*templatestore.StreamStorage); ok {
+		return nil, fmt.Errorf("the font registry needs a disk or s3 file storage, not stream")
+	}
+
+	r := &FontRegistry{store: store, prefix: prefix, content: map[string][]byte{}}
+	index, err := r.read(ctx, fontIndexFile)
+	if err != nil {
+		if templatestore.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read font index: %w", err)
+	}
+	if err := json.Unmarshal(index, &r.fonts); err != nil {
+		return nil, fmt.Errorf("invalid font index: %v", err)
+	}
+	return r, nil
+}
+
+// Add stores a font face, replacing the face with the same family, weight
+// and style if there is one.
+func (r *FontRegistry) Add(ctx context.Context, req *AddFontRequest) (*Font, error) {
+	font := &Font{Family: strings.TrimSpace(req.Family), Weight: req.Weight, Style: req.Style, Size: len(req.Content)}
+	if !fontFamilyRegex.MatchString(font.Family) {
+		return nil, fmt.Errorf("%w family %q: only ASCII letters, digits, spaces, - and _ are allowed", ErrInvalidFont, req.Family)
+	}
+	if font.Weight == "" {
+		font.Weight = "400"
+	}
+	if !fontWeightRegex.MatchString(font.Weight) {
+		return nil, fmt.Errorf("%w weight %q: expected e.g. 400 or \"100 900\"", ErrInvalidFont, req.Weight)
+	}
+	switch font.Style {
+	case "":
+		font.Style = "normal"
+	case "normal", "italic":
+	default:
+		return nil, fmt.Errorf("%w style %q: expected normal or italic", ErrInvalidFont, req.Style)
+	}
+	for format, f := range fontFormats {
+		if bytes.HasPrefix(req.Content, f.magic) {
+			font.Format = format
+		}
+	}
+	if font.Format == "" {
+		return nil, fmt.Errorf("%w: only TTF, OTF and WOFF2 fonts are accepted", ErrInvalidFont)
+	}
+	sum := sha256.Sum256(req.Content)
+	font.ID = hex.EncodeToString(sum[:8])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.write(ctx, font.path(), req.Content); err != nil {
+		return nil, fmt.Errorf("failed to store font: %w", err)
+	}
+
+	fonts := []*Font{}
+	for _, f := range r.fonts {
+		if f.Family != font.Family || f.Weight != font.Weight || f.Style != font.Style {
+			fonts = append(fonts, f)
+		}
+	}
+	fonts = append(fonts, font)
+	sort.Slice(fonts, func(i, j int) bool {
+		if fonts[i].Family != fonts[j].Family {
+			return fonts[i].Family < fonts[j].Family
+		}
+		return fonts[i].Weight+fonts[i].Style < fonts[j].Weight+fonts[j].Style
+	})
+
+	index, err := json.Marshal(fonts)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.write(ctx, fontIndexFile, index); err != nil {
+		return nil, fmt.Errorf("failed to store font index: %w", err)
+	}
+	r.fonts = fonts
+	r.content[font.ID] = req.Content
+	return font, nil
+}
+
+// List returns the registered font faces, sorted by family.
+func (r *FontRegistry) List() []Font {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fonts := make([]Font, len(r.fonts))
+	for i, f := range r.fonts {
+		fonts[i] = *f
+	}
+	return fonts
+}
+
+// Version changes whenever a font face is added or replaced.
+func (r *FontRegistry) Version() string {
+	h := sha256.New()
+	for _, f := range r.List() {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\n", f.ID, f.Family, f.Weight, f.Style)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fontFaceCSS returns an @font-face rule for every registered face.
+func (r *FontRegistry) fontFaceCSS() string {
+	var css strings.Builder
+	for _, f := range r.List() {
+		fmt.Fprintf(&css, "@font-face{font-family:%q;font-weight:%s;font-style:%s;src:url(%s/%s%s) format(%q)}",
+			f.Family, f.Weight, f.Style, browser_manager.AssetOrigin, fontAssetPrefix, f.path(), f.Format)
+	}
+	return css.String()
+}
+
+// assets serves the registered fonts under fontAssetPrefix, recording the
+// faces served in used, and every other path from next, which may be nil.
+func (r *FontRegistry) assets(next browser_manager.AssetFunc, used *fontUsage) browser_manager.AssetFunc {
+	return func(ctx context.Context, path string) ([]byte, string, error) {
+		name, ok := strings.CutPrefix(path, fontAssetPrefix)
+		if !ok {
+			if next == nil {
+				return nil, "", browser_manager.ErrAssetNotFound
+			}
+			return next(ctx, path)
+		}
+
+		font := r.font(name)
+		if font == nil {
+			return nil, "", browser_manager.ErrAssetNotFound
+		}
+		content, err := r.fontContent(ctx, font)
+		if err != nil {
+			return nil, "", err
+		}
+		used.add(font)
+		return content, fontFormats[font.Format].mime, nil
+	}
+}
+
+func (r *FontRegistry) font(path string) *Font {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.fonts {
+		if f.path() == path {
+			return f
+		}
+	}
+	return nil
+}
+
+func (r *FontRegistry) fontContent(ctx context.Context, font *Font) ([]byte, error) {
+	r.mu.RLock()
+	content, ok := r.content[font.ID]
+	r.mu.RUnlock()
+	if ok {
+		return content, nil
+	}
+
+	content, err := r.read(ctx, font.path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %w", font.ID, err)
+	}
+	r.mu.Lock()
+	r.content[font.ID] = content
+	r.mu.Unlock()
+	return content, nil
+}
+
+func (r *FontRegistry) read(ctx context.Context, name string) ([]byte, error) {
+	path := r.prefix + name
+	reader, err := r.store.GetDocument(ctx, &templatestore.GetDocumentRequest{FilePath: path, FileS3Path: path})
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := reader.(io.Closer); ok {
+		defer c.Close()
+	}
+	return io.ReadAll(reader)
+}
+
+func (r *FontRegistry) write(ctx context.Context, name string, content []byte) error {
+	path := r.prefix + name
+	var reader io.Reader = bytes.NewReader(content)
+	_, err := r.store.PutDocument(ctx, &templatestore.PostDocumentRequest{FilePath: path, FileS3Path: path}, &reader)
+	return err
+}
+
+// fontUsage collects the faces served to a render.
+type fontUsage struct {
+	mu    sync.Mutex
+	fonts []Font
+}
+
+func (u *fontUsage) add(font *Font) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, f := range u.fonts {
+		if f.ID == font.ID {
+			return
+		}
+	}
+	u.fonts = append(u.fonts, *font)
+}
+
+func (u *fontUsage) list() []Font {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fonts := append([]Font(nil), u.fonts...)
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].Family < fonts[j].Family })
+	return fonts
+}
@@ -0,0 +1,49 @@
+package renderer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFontRegistry(t *testing.T) {
+	ctx := context.Background()
+	prefix := t.TempDir() + "/fonts/"
+	woff2 := append([]byte("wOF2"), 1, 2, 3)
+
+	registry, err := NewFontRegistry(ctx, &templatestore.DiskTemplateStorage{}, prefix)
+	require.NoError(t, err)
+
+	font, err := registry.Add(ctx, &AddFontRequest{Family: "Noto Sans Devanagari", Content: woff2})
+	require.NoError(t, err)
+	assert.Equal(t, "woff2", font.Format)
+	assert.Equal(t, "400", font.Weight)
+	assert.Equal(t, "normal", font.Style)
+
+	_, err = registry.Add(ctx, &AddFontRequest{Family: "Brand", Content: []byte("<html>")})
+	assert.ErrorIs(t, err, ErrInvalidFont)
+	_, err = registry.Add(ctx, &AddFontRequest{Family: `x"}body{`, Content: woff2})
+	assert.ErrorContains(t, err, "invalid font family")
+
+	// the index survives a restart
+	registry, err = NewFontRegistry(ctx, &templatestore.DiskTemplateStorage{}, prefix)
+	require.NoError(t, err)
+	assert.Equal(t, []Font{*font}, registry.List())
+	assert.Equal(t, `@font-face{font-family:"Noto Sans Devanagari";font-weight:400;font-style:normal;`+
+		`src:url(https://assets.espresso.invalid/_espresso/fonts/`+font.ID+`.woff2) format("woff2")}`, registry.fontFaceCSS())
+
+	used := &fontUsage{}
+	assets := registry.assets(nil, used)
+	content, contentType, err := assets(ctx, fontAssetPrefix+font.ID+".woff2")
+	require.NoError(t, err)
+	assert.Equal(t, woff2, content)
+	assert.Equal(t, "font/woff2", contentType)
+	assert.Equal(t, []Font{*font}, used.list())
+
+	_, _, err = assets(ctx, "logo.png")
+	assert.ErrorIs(t, err, browser_manager.ErrAssetNotFound)
+}
@@ -0,0 +1,180 @@
+package renderer
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Zomato/espresso/lib/logger"
+)
+
+// imageEntry is a fetched image and what is needed to revalidate it.
+type imageEntry struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"`
+	Body         []byte    `json:"-"`
+}
+
+func (e *imageEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e *imageEntry) revalidatable() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// cacheLifetime reads how long a response may be reused from its
+// Cache-Control header. It returns false for responses that must not be
+// stored. Without max-age, responses are kept for defaultTTL.
+func cacheLifetime(cacheControl string, defaultTTL time.Duration) (time.Duration, bool) {
+	ttl := defaultTTL
+	for _, directive := range strings.Split(strings.ToLower(cacheControl), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch name {
+		case "no-store", "private":
+			return 0, false
+		case "no-cache":
+			// stored, but revalidated before every use
+			return 0, true
+		case "max-age", "s-maxage":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return ttl, true
+}
+
+// imageCache is an LRU of fetched images bounded by entry count and bytes,
+// optionally backed by a directory that keeps entries evicted from memory
+// and across restarts.
+type imageCache struct {
+	maxEntries int
+	maxBytes   int64
+	dir        string
+
+	mu      sync.Mutex
+	bytes   int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newImageCache(maxEntries int, maxBytes int64, dir string) (*imageCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &imageCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		dir:        dir,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}, nil
+}
+
+func (c *imageCache) get(url string) *imageEntry {
+	c.mu.Lock()
+	if el, ok := c.entries[url]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*imageEntry)
+	}
+	c.mu.Unlock()
+
+	entry := c.readDisk(url)
+	if entry != nil {
+		c.remember(entry)
+	}
+	return entry
+}
+
+func (c *imageCache) set(entry *imageEntry) {
+	if int64(len(entry.Body)) > c.maxBytes {
+		return
+	}
+	c.remember(entry)
+	c.writeDisk(entry)
+}
+
+func (c *imageCache) remember(entry *imageEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[entry.URL]; ok {
+		c.bytes -= int64(len(el.Value.(*imageEntry).Body))
+		c.lru.Remove(el)
+	}
+	c.entries[entry.URL] = c.lru.PushFront(entry)
+	c.bytes += int64(len(entry.Body))
+
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*imageEntry)
+		delete(c.entries, evicted.URL)
+		c.bytes -= int64(len(evicted.Body))
+	}
+}
+
+func (c *imageCache) diskPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// readDisk reads an entry written by writeDisk: its metadata as a JSON line,
+// followed by the body.
+func (c *imageCache) readDisk(url string) *imageEntry {
+	if c.dir == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(c.diskPath(url))
+	if err != nil {
+		return nil
+	}
+	meta, body, ok := strings.Cut(string(raw), "\n")
+	entry := &imageEntry{}
+	if !ok || json.Unmarshal([]byte(meta), entry) != nil || entry.URL != url {
+		return nil
+	}
+	entry.Body = []byte(body)
+	return entry
+}
+
+func (c *imageCache) writeDisk(entry *imageEntry) {
+	if c.dir == "" {
+		return
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// written aside and renamed so readers never see half an entry
+	path := c.diskPath(entry.URL)
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err == nil {
+		_, err = tmp.Write(append(append(meta, '\n'), entry.Body...))
+		err = errors.Join(err, tmp.Close())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		if tmp != nil {
+			os.Remove(tmp.Name())
+		}
+		log.Logger.Error(context.Background(), "failed to write image to disk cache", err, map[string]any{"url": entry.URL})
+	}
+}
@@ -0,0 +1,117 @@
+package renderer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newTestFetcher(t *testing.T, conf ImageFetchConfig) *imageFetcher {
+	t.Cleanup(func() { ConfigureImageFetch(ImageFetchConfig{}) })
+	require.NoError(t, ConfigureImageFetch(conf))
+	return fetcher.Load()
+}
+
+func TestImageFetchCachesAndRevalidates(t *testing.T) {
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		switch r.URL.Path {
+		case "/fresh.png":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/stale.png":
+			w.Header().Set("Cache-Control", "no-cache")
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/private.png":
+			w.Header().Set("Cache-Control", "private")
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG)
+	}))
+	defer server.Close()
+
+	f := newTestFetcher(t, ImageFetchConfig{})
+	ctx := context.Background()
+
+	for _, path := range []string{"/fresh.png", "/stale.png", "/private.png"} {
+		for i := 0; i < 2; i++ {
+			entry, err := f.fetch(ctx, server.URL+path)
+			require.NoError(t, err)
+			assert.Equal(t, testPNG, entry.Body)
+			assert.Equal(t, "image/png", entry.ContentType)
+		}
+	}
+	// fresh is fetched once, stale is revalidated and private is never stored
+	assert.Equal(t, int32(5), requests.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestImageFetchLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("<!DOCTYPE html>login"))
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.7"))
+		case "/slow.png":
+			time.Sleep(200 * time.Millisecond)
+			w.Write(testPNG)
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(append(testPNG, make([]byte, 64)...))
+		}
+	}))
+	defer server.Close()
+
+	f := newTestFetcher(t, ImageFetchConfig{Timeout: 50 * time.Millisecond, MaxImageBytes: 32, MaxRequestBytes: 40, CacheEntries: -1})
+	ctx := context.Background()
+
+	_, err := f.fetch(ctx, server.URL+"/page.png")
+	assert.ErrorContains(t, err, "not an image")
+	_, err = f.fetch(ctx, server.URL+"/doc.pdf")
+	assert.ErrorContains(t, err, "not an image: content type application/pdf")
+	_, err = f.fetch(ctx, server.URL+"/large.png")
+	assert.ErrorContains(t, err, "larger than the 32 byte limit")
+	_, err = f.fetch(ctx, server.URL+"/slow.png")
+	assert.ErrorContains(t, err, "Client.Timeout")
+
+	budget := newImageBudget(f.conf.MaxRequestBytes)
+	assert.NoError(t, budget.take(int64(len(testPNG))))
+	assert.NoError(t, budget.take(int64(len(testPNG))))
+	assert.ErrorContains(t, budget.take(int64(len(testPNG))), "image budget")
+}
+
+func TestImageCacheEvictsAndPersists(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newImageCache(2, 1<<20, dir)
+	require.NoError(t, err)
+
+	for _, url := range []string{"a", "b", "c"} {
+		cache.set(&imageEntry{URL: url, ContentType: "image/png", Body: testPNG, Expires: time.Now().Add(time.Hour)})
+	}
+	assert.Equal(t, 2, cache.lru.Len())
+	assert.NotContains(t, cache.entries, "a")
+
+	// evicted from memory, still on disk
+	restarted, err := newImageCache(2, 1<<20, dir)
+	require.NoError(t, err)
+	entry := restarted.get("a")
+	require.NotNil(t, entry)
+	assert.Equal(t, testPNG, entry.Body)
+	assert.True(t, entry.fresh(time.Now()))
+}
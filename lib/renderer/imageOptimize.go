@@ -0,0 +1,332 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultImageQuality is the JPEG quality images are re-encoded at when
+// ImageOptions.Quality is not set.
+const DefaultImageQuality = 85
+
+// maxDecodePixels guards against images that are small on the wire but
+// decode to gigabytes. Larger images are inlined untouched.
+const maxDecodePixels = 64 << 20
+
+// ImageOptions shrink the images PrefetchImages inlines, so a pasted camera
+// photo does not turn into a 30MB PDF. With any option set, images are
+// downscaled to the pixel limit, re-encoded and stripped of metadata as
+// asked, and TIFF and BMP images are converted to JPEG, or PNG when they
+// have transparency. GIF images are never touched, and SVG images only
+// when RasterizeSVG is set.
+//
+// A template can set its own defaults with a meta tag, which the options
+// passed with a request override field by field:
+//
+//	<meta name="espresso-images" content="max-dimension=2000; dpi=150; quality=80; strip-metadata; rasterize-svg">
+type ImageOptions struct {
+	// MaxDimension caps the longest side of an image, in pixels.
+	MaxDimension int
+	// DPI caps images at this many pixels per inch of the longest side of
+	// the paper, since no image can be printed larger than the page.
+	DPI float64
+	// Quality re-encodes JPEG and WebP images at this JPEG quality, 1-100.
+	// WebP images are re-encoded as JPEG, or PNG when they have
+	// transparency.
+	Quality int
+	// StripMetadata drops EXIF, including location, and other metadata from
+	// JPEG and PNG images. The EXIF orientation is applied first.
+	StripMetadata bool
+	// RasterizeSVG draws SVG images as PNGs at MaxDimension, or
+	// DefaultSVGRasterSize, along their longest side.
+	RasterizeSVG bool
+}
+
+func (o ImageOptions) any() bool {
+	return o.MaxDimension > 0 || o.DPI > 0 || o.Quality > 0 || o.StripMetadata || o.RasterizeSVG
+}
+
+func (o ImageOptions) validate() error {
+	if o.MaxDimension < 0 || o.DPI < 0 {
+		return fmt.Errorf("image limits cannot be negative")
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("image quality must be between 1 and 100, got %d", o.Quality)
+	}
+	return nil
+}
+
+// merge returns o with the fields set in override replacing its own.
+func (o ImageOptions) merge(override *ImageOptions) ImageOptions {
+	if override == nil {
+		return o
+	}
+	if override.MaxDimension > 0 {
+		o.MaxDimension = override.MaxDimension
+	}
+	if override.DPI > 0 {
+		o.DPI = override.DPI
+	}
+	if override.Quality > 0 {
+		o.Quality = override.Quality
+	}
+	o.StripMetadata = o.StripMetadata || override.StripMetadata
+	o.RasterizeSVG = o.RasterizeSVG || override.RasterizeSVG
+	return o
+}
+
+var imagesMetaPattern = regexp.MustCompile(`(?is)<meta\s+name=["']espresso-images["']\s+content=(?:"([^"]*)"|'([^']*)')`)
+
+// templateImageOptions reads the espresso-images meta tag of a template's
+// source, if it has one. Images are prefetched before the template is
+// executed, so the tag cannot come from the template's data.
+func templateImageOptions(source string) (ImageOptions, error) {
+	var o ImageOptions
+	match := imagesMetaPattern.FindStringSubmatch(source)
+	if match == nil {
+		return o, nil
+	}
+
+	for _, token := range strings.Split(html.UnescapeString(match[1]+match[2]), ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(token), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case "":
+		case "max-dimension":
+			o.MaxDimension, err = strconv.Atoi(value)
+		case "dpi":
+			o.DPI, err = strconv.ParseFloat(value, 64)
+		case "quality":
+			o.Quality, err = strconv.Atoi(value)
+		case "strip-metadata":
+			o.StripMetadata = true
+		case "rasterize-svg":
+			o.RasterizeSVG = true
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return o, fmt.Errorf("invalid espresso-images meta tag: %v", err)
+		}
+	}
+	return o, o.validate()
+}
+
+// imageProcessor applies ImageOptions resolved for a paper size.
+type imageProcessor struct {
+	maxDimension int
+	quality      int
+	recompress   bool
+	strip        bool
+	rasterizeSVG bool
+}
+
+// processor returns nil when o asks for nothing. paperInches is the longest
+// side of the paper the images are printed on.
+func (o ImageOptions) processor(paperInches float64) *imageProcessor {
+	if !o.any() {
+		return nil
+	}
+	p := &imageProcessor{maxDimension: o.MaxDimension, quality: o.Quality, recompress: o.Quality > 0, strip: o.StripMetadata, rasterizeSVG: o.RasterizeSVG}
+	if o.DPI > 0 && paperInches > 0 {
+		if limit := int(o.DPI * paperInches); p.maxDimension == 0 || limit < p.maxDimension {
+			p.maxDimension = limit
+		}
+	}
+	if p.quality == 0 {
+		p.quality = DefaultImageQuality
+	}
+	return p
+}
+
+// process returns content shrunk as asked, and its content type. Images it
+// cannot or need not change are returned as they are.
+func (p *imageProcessor) process(content []byte, contentType string) ([]byte, string, error) {
+	if contentType == "image/svg+xml" {
+		if !p.rasterizeSVG {
+			return content, contentType, nil
+		}
+		size := p.maxDimension
+		if size == 0 {
+			size = DefaultSVGRasterSize
+		}
+		raster, err := rasterizeSVG(content, size)
+		if err != nil {
+			return nil, "", err
+		}
+		return raster, "image/png", nil
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || format == "gif" || config.Width*config.Height > maxDecodePixels {
+		return content, contentType, nil
+	}
+
+	scale := p.maxDimension > 0 && max(config.Width, config.Height) > p.maxDimension
+	convert := format == "tiff" || format == "bmp"
+	recompress := p.recompress && (format == "jpeg" || format == "webp")
+	strip := p.strip && (format == "jpeg" || format == "png")
+	if !scale && !convert && !recompress && !strip {
+		return content, contentType, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s image: %v", format, err)
+	}
+	if scale {
+		img = downscale(img, p.maxDimension)
+	}
+	if format == "jpeg" {
+		// re-encoding drops the EXIF orientation, so it is applied to the pixels
+		img = orient(img, jpegOrientation(content))
+	}
+
+	var out bytes.Buffer
+	outType := "image/jpeg"
+	if format == "png" || !isOpaque(img) {
+		outType = "image/png"
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&out, img)
+	} else {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: p.quality})
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	if !scale && !convert && !strip && out.Len() >= len(content) {
+		// already compressed at least this well
+		return content, contentType, nil
+	}
+	return out.Bytes(), outType, nil
+}
+
+func downscale(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width >= height {
+		width, height = maxDimension, max(1, height*maxDimension/width)
+	} else {
+		width, height = max(1, width*maxDimension/height), maxDimension
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// orient turns img upright for an EXIF orientation, 1 to 8.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// orientations 5-8 swap the sides
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG, or 1 if it has
+// none.
+func jpegOrientation(content []byte) int {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(content); {
+		if content[i] != 0xFF {
+			return 1
+		}
+		marker := content[i+1]
+		size := int(binary.BigEndian.Uint16(content[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(content) {
+			// the image data starts, no EXIF before it
+			return 1
+		}
+		segment := content[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,80 @@
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
+)
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with an orientation after the SOI
+// marker of a JPEG.
+func withOrientation(t *testing.T, img image.Image, orientation byte) []byte {
+	var out bytes.Buffer
+	require.NoError(t, jpeg.Encode(&out, img, nil))
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00")
+	exif = append(exif, orientation, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	return append(append([]byte{0xFF, 0xD8}, segment...), out.Bytes()[2:]...)
+}
+
+func TestImageProcessor(t *testing.T) {
+	photo := withOrientation(t, testImage(400, 200), 6)
+	assert.Equal(t, 6, jpegOrientation(photo))
+
+	p := ImageOptions{MaxDimension: 100, StripMetadata: true}.processor(11)
+	content, contentType, err := p.process(photo, "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Equal(t, 1, jpegOrientation(content))
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	require.NoError(t, err)
+	// downscaled, then turned upright
+	assert.Equal(t, 50, config.Width)
+	assert.Equal(t, 100, config.Height)
+
+	var bitmap bytes.Buffer
+	require.NoError(t, bmp.Encode(&bitmap, testImage(20, 20)))
+	content, contentType, err = ImageOptions{Quality: 80}.processor(11).process(bitmap.Bytes(), "image/bmp")
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Less(t, len(content), bitmap.Len())
+
+	// nothing to do for a small image without options that apply to it
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`)
+	content, contentType, err = ImageOptions{MaxDimension: 100}.processor(11).process(svg, "image/svg+xml")
+	require.NoError(t, err)
+	assert.Equal(t, svg, content)
+	assert.Equal(t, "image/svg+xml", contentType)
+
+	assert.Nil(t, ImageOptions{}.processor(11))
+	assert.Equal(t, 1650, ImageOptions{MaxDimension: 4000, DPI: 150}.processor(11).maxDimension)
+}
+
+func TestTemplateImageOptions(t *testing.T) {
+	o, err := templateImageOptions(`<head><meta name="espresso-images" content="max-dimension=2000; dpi=150; quality=80; strip-metadata"></head>`)
+	assert.NoError(t, err)
+	assert.Equal(t, ImageOptions{MaxDimension: 2000, DPI: 150, Quality: 80, StripMetadata: true}, o)
+
+	o = o.merge(&ImageOptions{Quality: 60})
+	assert.Equal(t, 60, o.Quality)
+	assert.Equal(t, 2000, o.MaxDimension)
+
+	_, err = templateImageOptions(`<meta name="espresso-images" content="quality=120">`)
+	assert.ErrorContains(t, err, "between 1 and 100")
+}
@@ -0,0 +1,131 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/Zomato/espresso/lib/s3"
+	"github.com/Zomato/espresso/lib/templatestore"
+)
+
+const (
+	storeImageScheme = "store://"
+	s3ImageScheme    = "s3://"
+)
+
+// ImageStores let PrefetchImages inline images that live in storage rather
+// than behind a public URL. Content values of the form store://<path> are
+// read with Store.GetDocument and s3://<bucket>/<key> with the client of the
+// bucket in S3. Either is inlined under the same size and type limits as
+// downloaded images.
+//
+// Callers choose the paths, so only paths and keys under one of Prefixes
+// are read, e.g. "signatures/". An empty prefix allows everything in the
+// stores.
+type ImageStores struct {
+	Store    templatestore.StorageAdapter
+	S3       map[string]*s3.S3Client
+	Prefixes []string
+}
+
+// errImageNotAllowed is wrapped by the errors of storage images outside the
+// configured buckets and prefixes. Its message makes them start with
+// reasonNotAllowed, like URLs the allowlist denies.
+var errImageNotAllowed = errors.New("not allowed")
+
+// isStorageImageURL reports whether value names an image in storage.
+func isStorageImageURL(value string) bool {
+	return strings.HasPrefix(value, storeImageScheme) || strings.HasPrefix(value, s3ImageScheme)
+}
+
+// resolve splits a store:// or s3:// URL into the reader of its object and
+// the object's cleaned path.
+func (s *ImageStores) resolve(url string) (func(ctx context.Context) (io.Reader, error), string, error) {
+	if s == nil {
+		return nil, "", fmt.Errorf("no image stores configured")
+	}
+
+	var (
+		client *s3.S3Client
+		raw    string
+	)
+	if rest, ok := strings.CutPrefix(url, s3ImageScheme); ok {
+		bucket, key, _ := strings.Cut(rest, "/")
+		client = s.S3[bucket]
+		if client == nil {
+			return nil, "", fmt.Errorf("bucket %q is not configured for images", bucket)
+		}
+		raw = key
+	} else {
+		if s.Store == nil {
+			return nil, "", fmt.Errorf("no file store configured for images")
+		}
+		raw = strings.TrimPrefix(url, storeImageScheme)
+	}
+
+	// query strings and fragments are not part of the object's path
+	if i := strings.IndexAny(raw, "?#"); i >= 0 {
+		raw = raw[:i]
+	}
+	p, err := templatestore.CleanAssetPath(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if !s.allowed(p) {
+		return nil, "", fmt.Errorf("path %q is outside the image store prefixes", p)
+	}
+
+	if client != nil {
+		return func(ctx context.Context) (io.Reader, error) {
+			return client.GetFileReader(ctx, p)
+		}, p, nil
+	}
+	return func(ctx context.Context) (io.Reader, error) {
+		return s.Store.GetDocument(ctx, &templatestore.GetDocumentRequest{FilePath: p, FileS3Path: p})
+	}, p, nil
+}
+
+func (s *ImageStores) allowed(p string) bool {
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(p, strings.TrimPrefix(prefix, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch reads the image at a store:// or s3:// URL.
+func (s *ImageStores) fetch(ctx context.Context, url string, maxBytes int64) (*imageEntry, error) {
+	open, p, err := s.resolve(url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errImageNotAllowed, err)
+	}
+
+	reader, err := open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image from storage: %w", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image bytes: %v", err)
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("image is larger than the %d byte limit", maxBytes)
+	}
+
+	// stores keep no content type, so the extension stands in for the header
+	contentType, err := imageContentType(mime.TypeByExtension(path.Ext(p)), content)
+	if err != nil {
+		return nil, err
+	}
+	return &imageEntry{URL: url, ContentType: contentType, Body: content}, nil
+}
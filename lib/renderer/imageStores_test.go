@@ -0,0 +1,69 @@
+package renderer
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/lib/workerpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchImagesFromStore(t *testing.T) {
+	workerpool.Initialize(2, 200*time.Millisecond)
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "signatures"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "signatures", "ceo.png"), testPNG, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "signatures", "note.png"), []byte("<html>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.png"), testPNG, 0644))
+
+	stores := &ImageStores{Store: &templatestore.DiskTemplateStorage{}, Prefixes: []string{"signatures/"}}
+	data := map[string]interface{}{
+		"signature": "store://signatures/ceo.png",
+		"note":      "store://signatures/note.png",
+		"secret":    "store://secret.png",
+		"escape":    "store://signatures/../secret.png",
+		"bucket":    "s3://other-bucket/signatures/ceo.png",
+	}
+	data, results, err := prefetchImages(context.Background(), data, &prefetchOptions{stores: stores})
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	assert.Equal(t, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(testPNG), data["signature"])
+	// unreadable images are left as they were, disallowed ones are dropped
+	// like URLs the allowlist denies
+	assert.Equal(t, "store://signatures/note.png", data["note"])
+	for _, key := range []string{"secret", "escape", "bucket"} {
+		assert.NotContains(t, data, key)
+	}
+	statuses := map[string]ImageStatus{}
+	for _, result := range results {
+		statuses[result.URL] = result.Status
+		if result.Status == ImageBlocked {
+			assert.True(t, strings.HasPrefix(result.Reason, reasonNotAllowed), result.Reason)
+		}
+	}
+	assert.Equal(t, map[string]ImageStatus{
+		"store://signatures/ceo.png":           ImageInlined,
+		"store://signatures/note.png":          ImageFailed,
+		"store://secret.png":                   ImageBlocked,
+		"store://signatures/../secret.png":     ImageBlocked,
+		"s3://other-bucket/signatures/ceo.png": ImageBlocked,
+	}, statuses)
+
+	// without stores the values are not images at all
+	data, results, err = PrefetchImages(context.Background(), map[string]interface{}{"signature": "store://signatures/ceo.png"}, ImagePolicy{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, "store://signatures/ceo.png", data["signature"])
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	htmltemplate "html/template"
 	"strings"
 	"sync"
 	"text/template"
@@ -21,6 +22,11 @@ func ExecuteTemplate(ctx context.Context, templateFile *template.Template, data
 	if templateFile == nil {
 		return "", fmt.Errorf("template file is nil")
 	}
+	return executeTemplate(ctx, templateFile, data)
+}
+
+// executeTemplate is ExecuteTemplate for a template in either escaping mode.
+func executeTemplate(ctx context.Context, templateFile executor, data map[string]interface{}) (string, error) {
 
 	// Get buffer from pool
 	buf := bufferPool.Get().(*bytes.Buffer)
@@ -40,8 +46,12 @@ func AddImagesFromMetaData(ctx context.Context, htmlContent string, unmarshaledD
 	if metadata, ok := unmarshaledData["metadata"].(map[string]interface{}); ok {
 		if images, ok := metadata["images"].(map[string]interface{}); ok {
 			for url, dataURI := range images {
-				if dataURIStr, ok := dataURI.(string); ok {
+				switch dataURIStr := dataURI.(type) {
+				case string:
 					htmlContent = strings.Replace(htmlContent, url, dataURIStr, -1)
+				case htmltemplate.URL:
+					// inlined by the prefetch for a template with html escaping
+					htmlContent = strings.Replace(htmlContent, url, string(dataURIStr), -1)
 				}
 			}
 		}
@@ -11,6 +11,8 @@ import (
 	"github.com/Zomato/espresso/lib/browser_manager"
 	log "github.com/Zomato/espresso/lib/logger"
 	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
 )
 
 func GetHtmlPdf(ctx context.Context, params *GetHtmlPdfInput, storeAdapter *templatestore.StorageAdapter) ([]byte, error) {
@@ -19,6 +21,12 @@ func GetHtmlPdf(ctx context.Context, params *GetHtmlPdfInput, storeAdapter *temp
 	if params == nil {
 		return nil, fmt.Errorf("params are required")
 	}
+	if params.Browser == nil {
+		return nil, fmt.Errorf("browser manager is required")
+	}
+	for _, list := range params.Allowlists {
+		ctx = browser_manager.WithAllowlist(ctx, list)
+	}
 
 	duration := time.Since(startTime)
 
@@ -26,14 +34,16 @@ func GetHtmlPdf(ctx context.Context, params *GetHtmlPdfInput, storeAdapter *temp
 
 	var err error
 	var templateFile *template.Template
+	var assets browser_manager.AssetFunc
 	if storeAdapter != nil {
 		templateFile, err = (*storeAdapter).GetTemplate(ctx, &params.TemplateRequest)
 		if err != nil {
 			return nil, fmt.Errorf("unable to get template file from store: %v", err)
 		}
+		assets = templateAssets(*storeAdapter, params.TemplateRequest)
 	} else {
 		if len(params.TemplateRequest.TemplateBytes) > 0 {
-			templateFile, err = template.New("stream").Parse(string(params.TemplateRequest.TemplateBytes))
+			templateFile, err = template.New("stream").Funcs(templatestore.Funcs()).Parse(string(params.TemplateRequest.TemplateBytes))
 			if err != nil {
 				return nil, fmt.Errorf("unable to parse template file: %v", err)
 			}
@@ -57,54 +67,199 @@ func GetHtmlPdf(ctx context.Context, params *GetHtmlPdfInput, storeAdapter *temp
 		unmarshaledData["metadata"] = metaInfo
 	}
 
-	page := browser_manager.GetTab()
-	defer func() {
-		duration = time.Since(startTime)
-		log.Logger.Info(ctx, "closing tab at", map[string]any{"duration": duration})
-		browser_manager.ReleaseTab(page)
-	}()
+	images, err := imageProcessorFor(templateFile, params)
+	if err != nil {
+		return nil, err
+	}
+
+	escaping, err := TemplateEscaping(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	var executable executor = templateFile
+	if escaping == EscapingHTML {
+		if executable, err = htmlTemplate(templateFile); err != nil {
+			return nil, err
+		}
+	}
 
 	duration = time.Since(startTime)
 	log.Logger.Info(ctx, "prefetching images at", map[string]any{"duration": duration})
-	unmarshaledData = PrefetchImages(ctx, unmarshaledData)
+	unmarshaledData, imageResults, err := prefetchImages(ctx, unmarshaledData, &prefetchOptions{
+		policy: params.ImagePolicy,
+		images: images,
+		stores: params.ImageStores,
+		// inlined images pass html escaping's URL filter
+		trusted: escaping == EscapingHTML,
+	})
+	if params.Report != nil {
+		params.Report.Images = imageResults
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to prefetch images: %w", err)
+	}
 
 	duration = time.Since(startTime)
 	log.Logger.Info(ctx, "unmarshaled data & started template execution at", map[string]any{"duration": duration})
 
-	htmlContent, err := ExecuteTemplate(ctx, templateFile, unmarshaledData)
+	htmlContent, err := executeTemplate(ctx, executable, unmarshaledData)
 	if err != nil {
 		return nil, fmt.Errorf("unable to execute template file: %v", err)
 	}
 
 	htmlContent = AddImagesFromMetaData(ctx, htmlContent, unmarshaledData)
+	if assets != nil {
+		htmlContent = withAssetBase(htmlContent, params.TemplateRequest.TemplateUUID)
+	}
+	var fontsUsed *fontUsage
+	if params.Fonts != nil {
+		// declared first so the template's own CSS takes precedence
+		if css := params.Fonts.fontFaceCSS(); css != "" {
+			htmlContent = insertIntoHead(htmlContent, "<style>"+css+"</style>")
+		}
+		fontsUsed = &fontUsage{}
+		assets = params.Fonts.assets(assets, fontsUsed)
+	}
+	if assets != nil {
+		// assets and fonts are served by the request filter of the tab
+		ctx = browser_manager.WithAssets(ctx, assets)
+	}
+
+	wait, err := templateWaitOptions(htmlContent)
+	if err != nil {
+		return nil, err
+	}
+	wait = wait.merge(params.Wait)
+	if params.IsSinglePage && wait.Until == "" {
+		// the height is measured once the page has loaded
+		wait.Until = WaitUntilLoad
+	}
+	if err := wait.validate(); err != nil {
+		return nil, err
+	}
 
 	duration = time.Since(startTime)
 	log.Logger.Info(ctx, "template executed and requesting new tab at", map[string]any{"duration": duration})
 
+	// a render that failed because the browser crashed is retried once on
+	// the relaunched browser
+	var pdfBytes []byte
+	err = params.Browser.WithTab(ctx, func(page *rod.Page) error {
+		timeout := params.RenderTimeout
+		if timeout <= 0 {
+			timeout = DefaultRenderTimeout
+		}
+		renderCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		// every CDP call of the render, printing included, is aborted once
+		// renderCtx is done
+		var err error
+		pdfBytes, err = renderPdf(renderCtx, page.Context(renderCtx), htmlContent, params, wait, startTime)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			return fmt.Errorf("render cancelled: %w", ctx.Err())
+		case renderCtx.Err() != nil:
+			return &RenderTimeoutError{Timeout: timeout, Err: err}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Report != nil && fontsUsed != nil {
+		params.Report.FontsUsed = fontsUsed.list()
+	}
+
+	duration = time.Since(startTime)
+	log.Logger.Info(ctx, "pdf generated at", map[string]any{"duration": duration})
+
+	return pdfBytes, nil
+}
+
+// imageProcessorFor combines the template's espresso-images meta tag with
+// the request's ImageOptions, resolved for the paper being printed on.
+func imageProcessorFor(templateFile *template.Template, params *GetHtmlPdfInput) (*imageProcessor, error) {
+	var source string
+	if templateFile.Tree != nil {
+		source = templateFile.Tree.Root.String()
+	}
+	options, err := templateImageOptions(source)
+	if err != nil {
+		return nil, err
+	}
+	options = options.merge(params.Images)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	// Chrome prints on Letter paper unless told otherwise
+	width, height := 8.5, 11.0
+	if params.PdfParams != nil {
+		if params.PdfParams.PaperWidth != nil {
+			width = *params.PdfParams.PaperWidth
+		}
+		if params.PdfParams.PaperHeight != nil {
+			height = *params.PdfParams.PaperHeight
+		}
+	}
 	if params.IsSinglePage {
-		page.MustSetViewport(794, 1124, 1.0, false)
-	} else {
+		// the page is as tall as the content, only its width bounds an image
+		height = 0
+	}
+	return options.processor(max(width, height)), nil
+}
+
+// renderPdf prints htmlContent to PDF in page.
+func renderPdf(ctx context.Context, page *rod.Page, htmlContent string, params *GetHtmlPdfInput, wait WaitOptions, startTime time.Time) ([]byte, error) {
+	defer func() {
+		duration := time.Since(startTime)
+		log.Logger.Info(ctx, "closing tab at", map[string]any{"duration": duration})
+	}()
+
+	viewport := &proto.EmulationSetDeviceMetricsOverride{Width: 794, Height: 1124, DeviceScaleFactor: 1.0}
+	if !params.IsSinglePage {
 		viewPortConfig := params.ViewPort
-		page.MustSetViewport(viewPortConfig.Width, viewPortConfig.Height, viewPortConfig.DeviceScaleFactor, viewPortConfig.IsMobile)
+		viewport = &proto.EmulationSetDeviceMetricsOverride{
+			Width:             viewPortConfig.Width,
+			Height:            viewPortConfig.Height,
+			DeviceScaleFactor: viewPortConfig.DeviceScaleFactor,
+			Mobile:            viewPortConfig.IsMobile,
+		}
+	}
+	if err := page.SetViewport(viewport); err != nil {
+		return nil, fmt.Errorf("unable to set viewport: %v", err)
 	}
 
-	duration = time.Since(startTime)
+	duration := time.Since(startTime)
 	log.Logger.Info(ctx, "rendering data in new tab at", map[string]any{"duration": duration})
 
-	err = page.SetDocumentContent(string(htmlContent))
+	waitCtx, cancel := context.WithTimeout(ctx, wait.timeout())
+	defer cancel()
+	waitPage := page.Context(waitCtx)
+	networkIdle := wait.watchNetwork(waitPage)
+
+	err := page.SetDocumentContent(string(htmlContent))
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate pdf: %v", err)
 	}
 
+	if wait.any() {
+		duration = time.Since(startTime)
+		log.Logger.Info(ctx, "waiting for page at", map[string]any{"duration": duration})
+
+		if err := waitForPage(waitCtx, waitPage, wait, networkIdle); err != nil {
+			return nil, err
+		}
+	}
+
 	pdfParams := params.PdfParams
 
 	if params.IsSinglePage { // to generate pdf of single page with dynamic height
 
-		err = page.WaitLoad()
-		if err != nil {
-			return nil, fmt.Errorf("error in waiting for page load: %v", err)
-		}
-
 		body, err := page.Element("html")
 		if err != nil {
 			return nil, fmt.Errorf("error in getting html element: %v", err)
@@ -144,9 +299,6 @@ func GetHtmlPdf(ctx context.Context, params *GetHtmlPdfInput, storeAdapter *temp
 		log.Logger.Error(ctx, "failed to close pdf stream", closeErr, nil)
 	}
 
-	duration = time.Since(startTime)
-	log.Logger.Info(ctx, "pdf generated at", map[string]any{"duration": duration})
-
 	return pdfBytes, nil
 }
 
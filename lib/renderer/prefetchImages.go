@@ -1,15 +1,21 @@
 package renderer
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
+	"mime"
 	"net/http"
 	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Zomato/espresso/lib/browser_manager"
@@ -19,21 +25,160 @@ import (
 
 var imageExtURLRegex = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|webp|bmp|svg|tiff?)(\?.*)?$`)
 
+// Image policies decide what happens to an image that cannot be inlined.
+const (
+	// ImagesLenient reports the image and renders without it. A disallowed
+	// URL is removed from the data, anything else is left as it was.
+	ImagesLenient = "lenient"
+	// ImagesStrict fails the render with an *ImageError.
+	ImagesStrict = "strict"
+	// ImagesPlaceholder replaces the image with ImagePolicy.Placeholder.
+	ImagesPlaceholder = "placeholder"
+)
+
+// DefaultImagePlaceholder is a transparent 1x1 PNG, used in placeholder mode
+// when ImagePolicy.Placeholder is not set.
+const DefaultImagePlaceholder = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAAC0lEQVR42mNgAAIAAAUAAen63NgAAAAASUVORK5CYII="
+
+// ImagePolicy decides what happens to images PrefetchImages cannot inline.
+type ImagePolicy struct {
+	// Mode is ImagesLenient, ImagesStrict or ImagesPlaceholder. Defaults to
+	// ImagesLenient.
+	Mode string
+	// Placeholder is the data URI or URL failed images are replaced with in
+	// placeholder mode.
+	Placeholder string
+}
+
+func (p ImagePolicy) validate() error {
+	switch p.Mode {
+	case "", ImagesLenient, ImagesStrict, ImagesPlaceholder:
+		return nil
+	}
+	return fmt.Errorf("unknown image policy %q", p.Mode)
+}
+
+// ImageStatus is what became of a value PrefetchImages looked at.
+type ImageStatus string
+
+const (
+	ImageInlined ImageStatus = "inlined"
+	// ImageFailed images could not be fetched, were too large or were not
+	// images at all.
+	ImageFailed ImageStatus = "failed"
+	// ImageBlocked images are not allowed by the allowlist.
+	ImageBlocked ImageStatus = "blocked"
+	// ImageSkipped values do not look like images, e.g. a link to a page.
+	// They are never failures: disallowed ones are removed from the data
+	// and the others left as they were.
+	ImageSkipped ImageStatus = "skipped"
+)
+
+// ImageResult reports one URL PrefetchImages found in the data.
+type ImageResult struct {
+	URL string
+	// Key is the path of the value in the data, e.g. customer.photo.
+	Key    string
+	Status ImageStatus
+	// Bytes is the size inlined, after processing.
+	Bytes    int
+	Duration time.Duration
+	// Reason explains why the image was not inlined.
+	Reason string
+	// Placeholder is set when the image was replaced with the placeholder.
+	Placeholder bool
+}
+
+func (r ImageResult) failed() bool {
+	return r.Status == ImageFailed || r.Status == ImageBlocked
+}
+
+// ImageError fails a render in strict mode, for the first image that could
+// not be inlined.
+type ImageError struct {
+	Result ImageResult
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("image %s at %s %s: %s", e.Result.URL, e.Result.Key, e.Result.Status, e.Result.Reason)
+}
+
+const reasonNotAllowed = "not allowed: "
+
 type stackItem struct {
 	key  string
 	data map[string]interface{}
 }
 
-// Prefetch images and replace their URLs with data URIs
-func PrefetchImages(ctx context.Context, data map[string]interface{}) map[string]interface{} {
+// prefetchOptions are what GetHtmlPdf adds to PrefetchImages.
+type prefetchOptions struct {
+	policy ImagePolicy
+	// images, if set, shrinks the images
+	images *imageProcessor
+	// stores, if set, serve store:// and s3:// images
+	stores *ImageStores
+	// trusted sets inlined images as html/template URLs, which html
+	// escaping writes as they are
+	trusted bool
+}
+
+func (o *prefetchOptions) inline(dataURI string) interface{} {
+	if o.trusted {
+		return htmltemplate.URL(dataURI)
+	}
+	return dataURI
+}
+
+// Prefetch images and replace their URLs with data URIs. Every URL found is
+// reported, sorted by key. In strict mode the first image that cannot be
+// inlined is returned as an *ImageError, along with the report so far.
+func PrefetchImages(ctx context.Context, data map[string]interface{}, policy ImagePolicy) (map[string]interface{}, []ImageResult, error) {
+	return prefetchImages(ctx, data, &prefetchOptions{policy: policy})
+}
+
+func prefetchImages(ctx context.Context, data map[string]interface{}, opts *prefetchOptions) (map[string]interface{}, []ImageResult, error) {
+	if err := opts.policy.validate(); err != nil {
+		return data, nil, err
+	}
 
 	startTime := time.Now()
+	budget := newImageBudget(fetcher.Load().conf.MaxRequestBytes)
 	var wg sync.WaitGroup
-	var mu sync.Mutex // to add lock on updating the json data
+	var mu sync.Mutex // to add lock on updating the json data, results and failure
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	errChan := make(chan error, 1)
+	var results []ImageResult
+	var failure *ImageError
+
+	// finish records a result and applies the policy to a failed image
+	finish := func(parentData map[string]interface{}, k string, result ImageResult, dataURI string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case result.Status == ImageInlined:
+			parentData[k] = opts.inline(dataURI)
+		case result.failed() && opts.policy.Mode == ImagesStrict:
+			if failure == nil {
+				failure = &ImageError{Result: result}
+				// the render fails anyway, the other downloads can stop
+				cancel()
+			}
+		case result.failed() && opts.policy.Mode == ImagesPlaceholder:
+			placeholder := opts.policy.Placeholder
+			if placeholder == "" {
+				placeholder = DefaultImagePlaceholder
+			}
+			parentData[k] = opts.inline(placeholder)
+			result.Placeholder = true
+		case strings.HasPrefix(result.Reason, reasonNotAllowed):
+			// Drop the disallowed URL from the template data so it
+			// never reaches the rendered HTML
+			delete(parentData, k)
+		}
+		results = append(results, result)
+	}
 
 	stack := []stackItem{{key: "", data: data}}
 
@@ -42,13 +187,15 @@ func PrefetchImages(ctx context.Context, data map[string]interface{}) map[string
 		stack = stack[:len(stack)-1]
 
 		for key, value := range current.data {
+			path := joinKey(current.key, key)
 			strValue, ok := value.(string)
-			if ok && (strings.HasPrefix(strValue, "https://")) {
+			if ok && (strings.HasPrefix(strValue, "https://") || isSVGDataURI(strValue) || (opts.stores != nil && isStorageImageURL(strValue))) {
 				wg.Add(1)
 				err := workerpool.Pool().SubmitTask(func(args ...interface{}) {
 					k := args[0].(string)
 					v := args[1].(string)
 					parentData := args[2].(map[string]interface{})
+					path := args[3].(string)
 
 					defer func() {
 						wg.Done()
@@ -58,61 +205,17 @@ func PrefetchImages(ctx context.Context, data map[string]interface{}) map[string
 						}
 					}()
 
-					allowed, reason := browser_manager.IsURLAllowed(v)
-					if !allowed {
-						// Drop the disallowed URL from the template data so it
-						// never reaches the rendered HTML
-						mu.Lock()
-						delete(parentData, k)
-						mu.Unlock()
-
-						if !imageExtURLRegex.MatchString(v) {
-							log.Logger.Info(ctx, "URL not allowed and has non-image extension", map[string]any{"url": v, "reason": reason})
-							return
-						}
-						err := fmt.Errorf("image URL not allowed: %s. Reason: %s", v, reason)
-						log.Logger.Error(ctx, "error while prefetching images", err, map[string]any{"url": v})
-						select {
-						case errChan <- err:
-							cancel()
-						default:
-						}
-						return
-					}
-
-					var dataURI string
-					var err error
-					if strings.HasPrefix(v, "https://") {
-						duration := time.Since(startTime)
-						log.Logger.Info(ctx, "fetching image at", map[string]any{"name": v, "duration": duration})
-						dataURI, err = fetchImageAsDataURIFromURL(v)
-						if err != nil {
-							log.Logger.Error(ctx, "failed to download image", err, map[string]any{"key": k})
-							return
-						}
-					}
-
-					if dataURI == "" {
-						log.Logger.Error(ctx, "failed to download image. data uri is empty", nil, map[string]any{"key": k})
-						mu.Lock()
-						parentData[k] = ""
-						mu.Unlock()
-						return
-					}
-
-					duration := time.Since(startTime)
-					log.Logger.Info(ctx, "fetched image data at", map[string]any{"duration": duration, "image": v})
-
-					mu.Lock()
-					parentData[k] = dataURI
-					mu.Unlock()
-					log.Logger.Info(ctx, "replaced image data at", map[string]any{"duration": duration, "key": k, "error": err})
-				}, key, strValue, current.data)
+					result, dataURI := prefetchImage(ctx, v, opts, budget)
+					result.Key = path
+					finish(parentData, k, result, dataURI)
+				}, key, strValue, current.data, path)
 				if err != nil {
+					wg.Done()
 					log.Logger.Error(ctx, "failed to submit task to worker pool", err, nil)
+					finish(current.data, key, ImageResult{URL: strValue, Key: path, Status: ImageFailed, Reason: err.Error()}, "")
 				}
 			} else if nestedMap, ok := value.(map[string]interface{}); ok {
-				stack = append(stack, stackItem{key: key, data: nestedMap})
+				stack = append(stack, stackItem{key: path, data: nestedMap})
 			} else if stringMap, ok := value.(map[string]string); ok {
 				interfaceMap := make(map[string]interface{})
 				for k, v := range stringMap {
@@ -120,7 +223,7 @@ func PrefetchImages(ctx context.Context, data map[string]interface{}) map[string
 				}
 
 				current.data[key] = interfaceMap
-				stack = append(stack, stackItem{key: key, data: interfaceMap})
+				stack = append(stack, stackItem{key: path, data: interfaceMap})
 			}
 		}
 	}
@@ -133,51 +236,344 @@ func PrefetchImages(ctx context.Context, data map[string]interface{}) map[string
 	duration = time.Since(startTime)
 	log.Logger.Info(ctx, "all worker pool tasks completed at", map[string]any{"duration": duration})
 
-	return data
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	if failure != nil {
+		return data, results, failure
+	}
+	return data, results, nil
 }
 
-var imageFetchClient = &http.Client{
-	CheckRedirect: func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
-	},
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
 }
 
-// Fetch an image and convert it to a data URI
-func fetchImageAsDataURIFromURL(url string) (string, error) {
+// prefetchImage fetches the image at url, and returns what became of it and
+// its data URI once inlined.
+func prefetchImage(ctx context.Context, url string, opts *prefetchOptions, budget *imageBudget) (ImageResult, string) {
 	startTime := time.Now()
+	result := ImageResult{URL: url}
+	if isSVGDataURI(url) {
+		// the content is no use in a report
+		result.URL = "data:image/svg+xml"
+	}
+	looksLikeImage := imageExtURLRegex.MatchString(url) || isStorageImageURL(url) || isSVGDataURI(url)
+
+	// storage paths are checked against the stores' prefixes instead, and
+	// inline images load nothing
+	if strings.HasPrefix(url, "https://") {
+		if allowed, reason := browser_manager.IsURLAllowedContext(ctx, url); !allowed {
+			result.Reason = reasonNotAllowed + reason
+			result.Status = ImageSkipped
+			if looksLikeImage {
+				result.Status = ImageBlocked
+				log.Logger.Error(ctx, "image URL not allowed", nil, map[string]any{"url": url, "reason": reason})
+			} else {
+				log.Logger.Info(ctx, "URL not allowed and has non-image extension", map[string]any{"url": url, "reason": reason})
+			}
+			return result, ""
+		}
+	}
 
-	duration := time.Since(startTime)
-	log.Logger.Info(context.Background(), "fetching image at", map[string]any{"duration": duration, "url": url})
+	log.Logger.Info(ctx, "fetching image at", map[string]any{"name": url})
+	dataURI, size, err := fetchImageAsDataURIFromURL(ctx, url, opts.images, opts.stores, budget)
+	result.Duration = time.Since(startTime)
+	switch {
+	case err == nil:
+		result.Status = ImageInlined
+		result.Bytes = size
+	case errors.Is(err, errImageNotAllowed):
+		log.Logger.Error(ctx, "image URL not allowed", nil, map[string]any{"url": url, "reason": err.Error()})
+		result.Status = ImageBlocked
+		result.Reason = err.Error()
+	case errors.Is(err, errNotImage) && !looksLikeImage:
+		// a link to a page, not an image that is missing
+		result.Status = ImageSkipped
+		result.Reason = err.Error()
+	default:
+		log.Logger.Error(ctx, "failed to download image", err, map[string]any{"url": url})
+		result.Status = ImageFailed
+		result.Reason = err.Error()
+	}
+	return result, dataURI
+}
+
+// ImageFetchConfig bounds how PrefetchImages downloads images and how long
+// it keeps them. Zero fields take the matching default.
+type ImageFetchConfig struct {
+	// Timeout bounds each download, headers and body included.
+	Timeout time.Duration
+	// MaxImageBytes is the largest image inlined.
+	MaxImageBytes int64
+	// MaxRequestBytes is the most image bytes inlined into one render.
+	MaxRequestBytes int64
+	// CacheEntries and CacheBytes bound the in-memory cache shared by all
+	// renders. A negative CacheEntries disables the cache.
+	CacheEntries int
+	CacheBytes   int64
+	// CacheTTL is how long images without a Cache-Control max-age are
+	// reused before they are revalidated.
+	CacheTTL time.Duration
+	// CacheDir, if set, keeps cached images on disk too, so they survive
+	// eviction from memory and restarts.
+	CacheDir string
+}
+
+const (
+	DefaultImageFetchTimeout = 10 * time.Second
+	DefaultMaxImageBytes     = 10 << 20
+	DefaultMaxRequestBytes   = 50 << 20
+	DefaultImageCacheEntries = 512
+	DefaultImageCacheBytes   = 128 << 20
+	DefaultImageCacheTTL     = time.Hour
+)
+
+type imageFetcher struct {
+	conf   ImageFetchConfig
+	client *http.Client
+	cache  *imageCache
+}
+
+var fetcher atomic.Pointer[imageFetcher]
 
-	resp, err := imageFetchClient.Get(url)
+func init() {
+	if err := ConfigureImageFetch(ImageFetchConfig{}); err != nil {
+		panic(err)
+	}
+}
+
+// ConfigureImageFetch replaces how images are downloaded and cached by
+// PrefetchImages. The cache starts empty, apart from what CacheDir holds.
+func ConfigureImageFetch(conf ImageFetchConfig) error {
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultImageFetchTimeout
+	}
+	if conf.MaxImageBytes <= 0 {
+		conf.MaxImageBytes = DefaultMaxImageBytes
+	}
+	if conf.MaxRequestBytes <= 0 {
+		conf.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if conf.CacheEntries == 0 {
+		conf.CacheEntries = DefaultImageCacheEntries
+	}
+	if conf.CacheBytes <= 0 {
+		conf.CacheBytes = DefaultImageCacheBytes
+	}
+	if conf.CacheTTL <= 0 {
+		conf.CacheTTL = DefaultImageCacheTTL
+	}
+
+	f := &imageFetcher{
+		conf: conf,
+		client: &http.Client{
+			Timeout: conf.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if conf.CacheEntries > 0 {
+		cache, err := newImageCache(conf.CacheEntries, conf.CacheBytes, conf.CacheDir)
+		if err != nil {
+			return fmt.Errorf("failed to create image cache: %v", err)
+		}
+		f.cache = cache
+	}
+	fetcher.Store(f)
+	return nil
+}
+
+// imageBudget is what is left of a render's MaxRequestBytes.
+type imageBudget struct {
+	left atomic.Int64
+}
+
+func newImageBudget(max int64) *imageBudget {
+	b := &imageBudget{}
+	b.left.Store(max)
+	return b
+}
+
+func (b *imageBudget) take(n int64) error {
+	if b.left.Add(-n) < 0 {
+		b.left.Add(n)
+		return fmt.Errorf("image of %d bytes exceeds what is left of the render's image budget", n)
+	}
+	return nil
+}
+
+// Fetch an image and convert it to a data URI. It returns the data URI and
+// the size of the image inlined.
+func fetchImageAsDataURIFromURL(ctx context.Context, url string, images *imageProcessor, stores *ImageStores, budget *imageBudget) (string, int, error) {
+	startTime := time.Now()
+	f := fetcher.Load()
+
+	var entry *imageEntry
+	var err error
+	switch {
+	case isSVGDataURI(url):
+		entry, err = dataURIEntry(url, f.conf.MaxImageBytes)
+	case isStorageImageURL(url):
+		entry, err = stores.fetch(ctx, url, f.conf.MaxImageBytes)
+	default:
+		entry, err = f.fetch(ctx, url)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch image: %v", err)
+		return "", 0, err
 	}
 
-	duration = time.Since(startTime)
-	log.Logger.Info(context.Background(), "fetched image at", map[string]any{"duration": duration, "url": url})
+	// cached entries are shared, so the processed image is a copy
+	content, contentType := entry.Body, entry.ContentType
+	if contentType == "image/svg+xml" {
+		// Chrome runs the scripts of an SVG opened from a data URI
+		content, err = sanitizeSVG(content)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	if images != nil {
+		content, contentType, err = images.process(content, contentType)
+		if err != nil {
+			return "", 0, err
+		}
+		if len(content) != len(entry.Body) {
+			log.Logger.Info(ctx, "image processed", map[string]any{"url": url, "bytes": len(entry.Body), "processed_bytes": len(content)})
+		}
+	}
+	if err := budget.take(int64(len(content))); err != nil {
+		return "", 0, err
+	}
+
+	// Encode the image as a data URI
+	dataURI := fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(content))
 
+	duration := time.Since(startTime)
+	log.Logger.Info(ctx, "returning image at", map[string]any{"duration": duration, "url": url})
+	return dataURI, len(content), nil
+}
+
+// fetch returns the image at url from the cache while it is fresh, and
+// downloads or revalidates it otherwise.
+func (f *imageFetcher) fetch(ctx context.Context, url string) (*imageEntry, error) {
+	var cached *imageEntry
+	if f.cache != nil {
+		cached = f.cache.get(url)
+		if cached != nil && cached.fresh(time.Now()) {
+			return cached, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %v", err)
+	}
+	if cached != nil && cached.revalidatable() {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %v", err)
+	}
 	defer resp.Body.Close()
 
+	ttl, storable := cacheLifetime(resp.Header.Get("Cache-Control"), f.conf.CacheTTL)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil && cached.revalidatable() {
+		log.Logger.Info(ctx, "cached image revalidated", map[string]any{"url": url})
+		refreshed := *cached
+		refreshed.Expires = time.Now().Add(ttl)
+		if storable {
+			f.cache.set(&refreshed)
+		}
+		return &refreshed, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch image, status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to fetch image, status code: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.conf.MaxImageBytes {
+		return nil, fmt.Errorf("image of %d bytes is larger than the %d byte limit", resp.ContentLength, f.conf.MaxImageBytes)
 	}
 
-	imageBytes, err := io.ReadAll(resp.Body)
+	imageBytes, err := io.ReadAll(io.LimitReader(resp.Body, f.conf.MaxImageBytes+1))
 	if err != nil {
-		return "", fmt.Errorf("failed to read image bytes: %v", err)
+		return nil, fmt.Errorf("failed to read image bytes: %v", err)
+	}
+	if int64(len(imageBytes)) > f.conf.MaxImageBytes {
+		return nil, fmt.Errorf("image is larger than the %d byte limit", f.conf.MaxImageBytes)
 	}
 
-	// Determine the content type of the image
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = http.DetectContentType(imageBytes)
+	contentType, err := imageContentType(resp.Header.Get("Content-Type"), imageBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	// Encode the image as a data URI
-	dataURI := fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(imageBytes))
+	entry := &imageEntry{
+		URL:          url,
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Expires:      time.Now().Add(ttl),
+		Body:         imageBytes,
+	}
+	if f.cache != nil && storable {
+		f.cache.set(entry)
+	}
+	return entry, nil
+}
 
-	duration = time.Since(startTime)
-	log.Logger.Info(context.Background(), "returning image at", map[string]any{"duration": duration, "url": url})
-	return dataURI, nil
+// dataURIEntry decodes an image inlined in the content.
+func dataURIEntry(uri string, maxBytes int64) (*imageEntry, error) {
+	content, err := decodeDataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("image is larger than the %d byte limit", maxBytes)
+	}
+	header, _, _ := strings.Cut(uri[len("data:"):], ",")
+	mediaType, _, _ := strings.Cut(header, ";")
+	contentType, err := imageContentType(mediaType, content)
+	if err != nil {
+		return nil, err
+	}
+	return &imageEntry{URL: uri, ContentType: contentType, Body: content}, nil
+}
+
+// errNotImage is wrapped by the errors of content that is not an image.
+var errNotImage = errors.New("not an image")
+
+// imageContentType returns the media type of an image from its
+// Content-Type header, or its content when the header is missing. Anything
+// that is not an image, by header or by content, is rejected.
+func imageContentType(header string, content []byte) (string, error) {
+	sniffed := http.DetectContentType(content)
+	contentType := sniffed
+	if header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return "", fmt.Errorf("invalid image content type %q: %v", header, err)
+		}
+		contentType = mediaType
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("%w: content type %s", errNotImage, contentType)
+	}
+	// sniffing cannot tell SVG, TIFF and some other images apart from text
+	// or binary data, but a page served as an image is caught. An SVG that
+	// starts with a comment sniffs as HTML too.
+	isSVG := contentType == "image/svg+xml" && bytes.Contains(content, []byte("<svg"))
+	if strings.HasPrefix(sniffed, "text/html") && !isSVG {
+		return "", fmt.Errorf("%w: %s content served as %s", errNotImage, sniffed, contentType)
+	}
+	return contentType, nil
 }
@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/lib/workerpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchImagesPolicies(t *testing.T) {
+	workerpool.Initialize(2, 200*time.Millisecond)
+	stores := &ImageStores{Store: &templatestore.DiskTemplateStorage{}, Prefixes: []string{"missing/"}}
+	newData := func() map[string]interface{} {
+		return map[string]interface{}{
+			"customer": map[string]interface{}{"photo": "store://missing/photo.png"},
+			"logo":     "https://blocked.example.com/logo.png",
+			"website":  "https://blocked.example.com/about",
+		}
+	}
+	ctx := context.Background()
+
+	data, results, err := prefetchImages(ctx, newData(), &prefetchOptions{stores: stores})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "customer.photo", results[0].Key)
+	assert.Equal(t, ImageFailed, results[0].Status)
+	assert.Equal(t, ImageBlocked, results[1].Status)
+	assert.Equal(t, ImageSkipped, results[2].Status)
+	// disallowed URLs are removed, the failed image is left as it was
+	assert.Equal(t, map[string]interface{}{"customer": map[string]interface{}{"photo": "store://missing/photo.png"}}, data)
+
+	data, results, err = prefetchImages(ctx, newData(), &prefetchOptions{stores: stores, policy: ImagePolicy{Mode: ImagesPlaceholder}})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultImagePlaceholder, data["customer"].(map[string]interface{})["photo"])
+	assert.Equal(t, DefaultImagePlaceholder, data["logo"])
+	assert.NotContains(t, data, "website")
+	assert.True(t, results[0].Placeholder)
+
+	_, results, err = prefetchImages(ctx, newData(), &prefetchOptions{stores: stores, policy: ImagePolicy{Mode: ImagesStrict}})
+	var imageErr *ImageError
+	require.ErrorAs(t, err, &imageErr)
+	assert.True(t, imageErr.Result.failed())
+	assert.Len(t, results, 3)
+
+	_, _, err = PrefetchImages(ctx, newData(), ImagePolicy{Mode: "ignore"})
+	assert.ErrorContains(t, err, `unknown image policy "ignore"`)
+}
@@ -11,13 +11,15 @@ import (
 	"github.com/Zomato/espresso/lib/workerpool"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetHtmlPdf(t *testing.T) {
 	ctx := context.Background()
 	os.Setenv("ROD_BROWSER_BIN", "/Applications/Google Chrome.app/Contents/MacOS/Google Chrome")
-	err := browser_manager.Init(ctx, 1)
-	assert.NoError(t, err)
+	browser, err := browser_manager.New(ctx, browser_manager.Config{TabsPerBrowser: 1})
+	require.NoError(t, err)
+	t.Cleanup(browser.Close)
 	concurrency := 2
 
 	workerpool.Initialize(concurrency,
@@ -106,6 +108,7 @@ func TestGetHtmlPdf(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Browser = browser
 			pdfBytes, err := GetHtmlPdf(ctx, tt.input, nil)
 			if tt.wantErr {
 				assert.Error(t, err)
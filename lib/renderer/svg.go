@@ -0,0 +1,284 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// DefaultSVGRasterSize is the longest side, in pixels, SVGs are rasterized
+// at when ImageOptions.MaxDimension is not set.
+const DefaultSVGRasterSize = 1200
+
+// svgDropElements are removed from SVGs with everything inside them. Besides
+// scripts and embedded HTML, animations go too, since they can set an href
+// after the sanitizer has looked at it.
+var svgDropElements = map[string]bool{
+	"script":           true,
+	"foreignobject":    true,
+	"handler":          true,
+	"listener":         true,
+	"iframe":           true,
+	"object":           true,
+	"embed":            true,
+	"audio":            true,
+	"video":            true,
+	"animate":          true,
+	"animatemotion":    true,
+	"animatetransform": true,
+	"set":              true,
+	"discard":          true,
+}
+
+var (
+	cssImportRegex = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssURLRegex    = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]*)['"]?\s*\)`)
+)
+
+// sanitizeSVG strips what lets an SVG run code or load anything: script,
+// foreignObject and similar elements, event handler attributes, processing
+// instructions such as xml-stylesheet, the DOCTYPE with its entities, and
+// every reference that does not point inside the SVG or at an inline raster
+// image.
+func sanitizeSVG(content []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.Entity = xml.HTMLEntity
+
+	var out bytes.Buffer
+	var open []xml.Name
+	dropped := 0 // depth inside a dropped element
+	sawSVG := false
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			open = append(open, t.Name)
+			if dropped > 0 || svgDropElements[strings.ToLower(t.Name.Local)] {
+				dropped++
+				continue
+			}
+			sawSVG = sawSVG || t.Name.Local == "svg"
+			out.WriteByte('<')
+			writeXMLName(&out, t.Name)
+			for _, attr := range t.Attr {
+				value, ok := sanitizeSVGAttr(attr)
+				if !ok {
+					continue
+				}
+				out.WriteByte(' ')
+				writeXMLName(&out, attr.Name)
+				out.WriteString(`="`)
+				xml.EscapeText(&out, []byte(value))
+				out.WriteByte('"')
+			}
+			out.WriteByte('>')
+		case xml.EndElement:
+			// RawToken does not match elements up, and a stray end tag must
+			// not end a dropped element early
+			if len(open) == 0 || open[len(open)-1] != t.Name {
+				return nil, fmt.Errorf("invalid SVG: unexpected </%s>", t.Name.Local)
+			}
+			open = open[:len(open)-1]
+			if dropped > 0 {
+				dropped--
+				continue
+			}
+			out.WriteString("</")
+			writeXMLName(&out, t.Name)
+			out.WriteByte('>')
+		case xml.CharData:
+			if dropped > 0 {
+				continue
+			}
+			text := string(t)
+			if len(open) > 0 && open[len(open)-1].Local == "style" {
+				text = sanitizeCSS(text)
+			}
+			xml.EscapeText(&out, []byte(text))
+		case xml.ProcInst:
+			if t.Target == "xml" && dropped == 0 {
+				fmt.Fprintf(&out, "<?xml %s?>", t.Inst)
+			}
+		}
+		// comments and directives are dropped
+	}
+	if !sawSVG {
+		return nil, fmt.Errorf("invalid SVG: no svg element")
+	}
+	return out.Bytes(), nil
+}
+
+func writeXMLName(out *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		out.WriteString(name.Space)
+		out.WriteByte(':')
+	}
+	out.WriteString(name.Local)
+}
+
+// sanitizeSVGAttr returns the value an attribute is kept with, or false if
+// it is dropped.
+func sanitizeSVGAttr(attr xml.Attr) (string, bool) {
+	name := strings.ToLower(attr.Name.Local)
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return "", false
+	case name == "href":
+		// href and xlink:href
+		return attr.Value, isInternalRef(attr.Value)
+	case attr.Name.Space == "xmlns" || name == "xmlns":
+		return attr.Value, true
+	}
+	return sanitizeCSS(attr.Value), true
+}
+
+// sanitizeCSS drops @import rules and points external url()s at nothing.
+// CSS escapes can spell both in ways the patterns do not see, e.g.
+// \75rl(...), so CSS with escapes is dropped whole unless decoding them
+// leaves nothing to strip.
+func sanitizeCSS(css string) string {
+	if strings.Contains(css, `\`) {
+		decoded := unescapeCSS(css)
+		if stripCSS(decoded) != decoded {
+			return ""
+		}
+	}
+	return stripCSS(css)
+}
+
+func stripCSS(css string) string {
+	css = cssImportRegex.ReplaceAllString(css, "")
+	return cssURLRegex.ReplaceAllStringFunc(css, func(match string) string {
+		if isInternalRef(cssURLRegex.FindStringSubmatch(match)[1]) {
+			return match
+		}
+		return "none"
+	})
+}
+
+// unescapeCSS decodes CSS escapes: a backslash and up to six hex digits,
+// with one optional whitespace after them, or a backslash and any other
+// character, which stands for itself.
+func unescapeCSS(css string) string {
+	var out strings.Builder
+	for i := 0; i < len(css); i++ {
+		if css[i] != '\\' || i+1 == len(css) {
+			out.WriteByte(css[i])
+			continue
+		}
+		j := i + 1
+		for j < len(css) && j-i <= 6 && isHexDigit(css[j]) {
+			j++
+		}
+		if j == i+1 {
+			// not hex: the next character stands for itself, and an escaped
+			// newline is a line continuation
+			if css[j] != '\n' {
+				out.WriteByte(css[j])
+			}
+			i = j
+			continue
+		}
+		code, _ := strconv.ParseUint(css[i+1:j], 16, 32)
+		if code == 0 || code > unicode.MaxRune || code >= 0xD800 && code <= 0xDFFF {
+			code = unicode.ReplacementChar
+		}
+		out.WriteRune(rune(code))
+		if j < len(css) && strings.IndexByte(" \t\n\r\f", css[j]) >= 0 {
+			j++
+		}
+		i = j - 1
+	}
+	return out.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isInternalRef reports whether a reference points inside the SVG or at an
+// inline raster image.
+func isInternalRef(ref string) bool {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	return strings.HasPrefix(ref, "#") ||
+		strings.HasPrefix(ref, "data:image/") && !strings.HasPrefix(ref, "data:image/svg")
+}
+
+// isSVGDataURI reports whether value is an SVG inlined in the content, which
+// is sanitized like a downloaded one.
+func isSVGDataURI(value string) bool {
+	return len(value) > len("data:image/svg+xml") && strings.EqualFold(value[:len("data:image/svg+xml")], "data:image/svg+xml")
+}
+
+// decodeDataURI returns the content of a data URI.
+func decodeDataURI(uri string) ([]byte, error) {
+	header, data, ok := strings.Cut(uri, ",")
+	if !ok {
+		return nil, fmt.Errorf("invalid data URI")
+	}
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		content, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI: %v", err)
+		}
+		return content, nil
+	}
+	content, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %v", err)
+	}
+	return []byte(content), nil
+}
+
+// rasterizeSVG draws an SVG as a PNG whose longest side is size pixels.
+// Only shapes are drawn: text, embedded images and filters are not.
+func rasterizeSVG(content []byte, size int) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to rasterize SVG: %v", r)
+		}
+	}()
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(content), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SVG: %v", err)
+	}
+	w, h := icon.ViewBox.W, icon.ViewBox.H
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("failed to rasterize SVG: it has no viewBox or size")
+	}
+	scale := float64(size) / max(w, h)
+	width, height := max(1, int(math.Round(w*scale))), max(1, int(math.Round(h*scale)))
+
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	return buf.Bytes(), nil
+}
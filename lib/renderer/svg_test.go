@@ -0,0 +1,86 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/workerpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unsafeSVG = `<?xml version="1.0"?>
+<!DOCTYPE svg [<!ENTITY x "boom">]>
+<?xml-stylesheet href="https://evil.example.com/a.css"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 40 20" onload="alert(1)">
+  <script>alert(2)</script>
+  <style>@import url(https://evil.example.com/b.css); rect { fill: url(#grad); stroke: url('https://evil.example.com/c.svg#s') }</style>
+  <foreignObject><div xmlns="http://www.w3.org/1999/xhtml"><img src="x" onerror="alert(3)"/></div></foreignObject>
+  <rect width="40" height="20" onclick="alert(4)" fill="url(https://evil.example.com/d.svg#p)"/>
+  <use xlink:href="#logo"/>
+  <image href="https://evil.example.com/e.png"/>
+  <a href="javascript:alert(5)"><set attributeName="href" to="javascript:alert(6)"/><text>hi &amp; bye</text></a>
+</svg>`
+
+func TestSanitizeSVG(t *testing.T) {
+	clean, err := sanitizeSVG([]byte(unsafeSVG))
+	require.NoError(t, err)
+	out := string(clean)
+
+	for _, unsafe := range []string{"alert", "evil.example.com", "script", "foreignObject", "DOCTYPE", "xml-stylesheet", "javascript", "<set"} {
+		assert.NotContains(t, out, unsafe)
+	}
+	for _, kept := range []string{`<?xml version="1.0"?>`, `xmlns:xlink="http://www.w3.org/1999/xlink"`, `fill: url(#grad)`, `<use xlink:href="#logo"></use>`, `hi &amp; bye`, `fill="none"`} {
+		assert.Contains(t, out, kept)
+	}
+
+	// CSS escapes hiding url( and @import
+	clean, err = sanitizeSVG([]byte(`<svg xmlns="http://www.w3.org/2000/svg">` +
+		`<style>rect{fill:\75rl(https://evil.example/x)}</style>` +
+		`<style>@\69mport "https://evil.example/a.css";</style>` +
+		`<rect style="background:\75 rl(https://evil.example/y)"/>` +
+		`<rect style="fill:\55RL(#grad)" class="a\:b"/></svg>`))
+	require.NoError(t, err)
+	out = string(clean)
+	assert.NotContains(t, out, "evil.example")
+	assert.Contains(t, out, `style="fill:\55RL(#grad)"`)
+	assert.Contains(t, out, `class="a\:b"`)
+
+	_, err = sanitizeSVG([]byte(`<svg><script></g>alert(1)</script></svg>`))
+	assert.ErrorContains(t, err, "unexpected </g>")
+	_, err = sanitizeSVG([]byte(`<html><body/></html>`))
+	assert.ErrorContains(t, err, "no svg element")
+}
+
+func TestPrefetchInlineSVG(t *testing.T) {
+	workerpool.Initialize(2, 200*time.Millisecond)
+	ctx := context.Background()
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20"><rect width="40" height="20" fill="#c00" onclick="alert(1)"/></svg>`
+
+	data, results, err := PrefetchImages(ctx, map[string]interface{}{"badge": "data:image/svg+xml," + url.PathEscape(svg)}, ImagePolicy{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "data:image/svg+xml", results[0].URL)
+	content, err := decodeDataURI(data["badge"].(string))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "alert")
+
+	images := ImageOptions{RasterizeSVG: true, MaxDimension: 100}.processor(11)
+	data, _, err = prefetchImages(ctx, map[string]interface{}{"badge": "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))}, &prefetchOptions{images: images})
+	require.NoError(t, err)
+	uri := data["badge"].(string)
+	require.True(t, strings.HasPrefix(uri, "data:image/png;base64,"))
+	content, err = decodeDataURI(uri)
+	require.NoError(t, err)
+	raster, _, err := image.Decode(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), raster.Bounds())
+	r, _, _, _ := raster.At(50, 25).RGBA()
+	assert.Equal(t, uint32(0xcccc), r)
+}
@@ -0,0 +1,73 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/internal/cdptest"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/go-rod/rod/lib/cdp"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTimeoutDiscardsTab(t *testing.T) {
+	ctx := context.Background()
+	browser := cdptest.NewServer()
+	t.Cleanup(browser.Close)
+	// the page never finishes printing
+	browser.Hang("Page.printToPDF", true)
+
+	manager, err := browser_manager.New(ctx, browser_manager.Config{
+		TabsPerBrowser: 1,
+		Remote:         browser_manager.RemoteConfig{URLs: []string{browser.URL}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(manager.Close)
+	require.Len(t, browser.Targets(), 1)
+
+	start := time.Now()
+	_, err = GetHtmlPdf(ctx, &GetHtmlPdfInput{
+		Browser:         manager,
+		TemplateRequest: templatestore.GetTemplateRequest{TemplateBytes: []byte(`<p>{{.title}}</p>`)},
+		Data:            []byte(`{"title":"slow"}`),
+		ViewPort:        &browser_manager.ViewportConfig{Width: 794, Height: 1124, DeviceScaleFactor: 1},
+		PdfParams:       &proto.PagePrintToPDF{},
+		RenderTimeout:   200 * time.Millisecond,
+	}, nil)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	var timedOut *RenderTimeoutError
+	require.ErrorAs(t, err, &timedOut)
+	assert.Equal(t, 200*time.Millisecond, timedOut.Timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, timedOut.Err, "unable to generate pdf")
+
+	// the tab may still be printing, so it is closed and replaced
+	require.Eventually(t, func() bool {
+		targets := browser.Targets()
+		closed := 0
+		for _, isClosed := range targets {
+			if isClosed {
+				closed++
+			}
+		}
+		return len(targets) == 2 && closed == 1 && manager.Stats().Browsers[0].IdleTabs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRenderTimeoutErrorUnwrap(t *testing.T) {
+	cause := &cdp.Error{Code: -32000, Message: "Printing failed"}
+	var err error = &RenderTimeoutError{Timeout: time.Second, Err: cause}
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, cause)
+	var cdpErr *cdp.Error
+	require.ErrorAs(t, err, &cdpErr)
+	assert.Equal(t, "Printing failed", cdpErr.Message)
+	assert.False(t, errors.Is(err, context.Canceled))
+}
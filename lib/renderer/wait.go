@@ -0,0 +1,200 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Events WaitOptions.Until can wait for.
+const (
+	WaitUntilLoad             = "load"
+	WaitUntilDOMContentLoaded = "domcontentloaded"
+)
+
+// DefaultWaitTimeout bounds the waits when WaitOptions.Timeout is not set.
+const DefaultWaitTimeout = 10 * time.Second
+
+// WaitOptions decide what the page must finish before it is printed, so JS
+// drawn charts, web fonts and lazy images are not cut off. The waits run in
+// the order of the fields and all of them must finish within Timeout.
+//
+// A template can set its own defaults with a meta tag, which the options
+// passed with a request override field by field:
+//
+//	<meta name="espresso-wait" content="load; network-idle=500ms; selector=#chart; ready; fonts; timeout=15s">
+type WaitOptions struct {
+	// Until is WaitUntilLoad or WaitUntilDOMContentLoaded.
+	Until string
+	// NetworkIdle waits until no request has been in flight for this long.
+	NetworkIdle time.Duration
+	// Fonts waits for document.fonts.ready.
+	Fonts bool
+	// Selector waits until an element matches this CSS selector.
+	Selector string
+	// ReadyFlag waits until the page sets window.espressoReady = true.
+	ReadyFlag bool
+	// Timeout bounds all the waits together. Defaults to DefaultWaitTimeout.
+	Timeout time.Duration
+}
+
+func (w WaitOptions) any() bool {
+	return w.Until != "" || w.NetworkIdle > 0 || w.Selector != "" || w.ReadyFlag || w.Fonts
+}
+
+func (w WaitOptions) timeout() time.Duration {
+	if w.Timeout > 0 {
+		return w.Timeout
+	}
+	return DefaultWaitTimeout
+}
+
+func (w WaitOptions) validate() error {
+	switch w.Until {
+	case "", WaitUntilLoad, WaitUntilDOMContentLoaded:
+	default:
+		return fmt.Errorf("unknown wait event %q, use %s or %s", w.Until, WaitUntilLoad, WaitUntilDOMContentLoaded)
+	}
+	if w.NetworkIdle < 0 || w.Timeout < 0 {
+		return fmt.Errorf("wait durations cannot be negative")
+	}
+	return nil
+}
+
+// merge returns w with the fields set in override replacing its own.
+func (w WaitOptions) merge(override *WaitOptions) WaitOptions {
+	if override == nil {
+		return w
+	}
+	if override.Until != "" {
+		w.Until = override.Until
+	}
+	if override.NetworkIdle > 0 {
+		w.NetworkIdle = override.NetworkIdle
+	}
+	if override.Selector != "" {
+		w.Selector = override.Selector
+	}
+	w.ReadyFlag = w.ReadyFlag || override.ReadyFlag
+	w.Fonts = w.Fonts || override.Fonts
+	if override.Timeout > 0 {
+		w.Timeout = override.Timeout
+	}
+	return w
+}
+
+var waitMetaPattern = regexp.MustCompile(`(?is)<meta\s+name=["']espresso-wait["']\s+content=(?:"([^"]*)"|'([^']*)')`)
+
+// templateWaitOptions reads the espresso-wait meta tag of a rendered
+// template, if it has one.
+func templateWaitOptions(htmlContent string) (WaitOptions, error) {
+	var w WaitOptions
+	match := waitMetaPattern.FindStringSubmatch(htmlContent)
+	if match == nil {
+		return w, nil
+	}
+
+	for _, token := range strings.Split(html.UnescapeString(match[1]+match[2]), ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(token), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case "":
+		case WaitUntilLoad, WaitUntilDOMContentLoaded:
+			w.Until = key
+		case "network-idle":
+			w.NetworkIdle, err = time.ParseDuration(value)
+		case "selector":
+			w.Selector = value
+		case "ready":
+			w.ReadyFlag = true
+		case "fonts":
+			w.Fonts = true
+		case "timeout":
+			w.Timeout, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return w, fmt.Errorf("invalid espresso-wait meta tag: %v", err)
+		}
+	}
+	return w, w.validate()
+}
+
+// watchNetwork starts tracking requests for the network idle wait. It has
+// to be called before the content is set, and the returned function waits.
+func (w WaitOptions) watchNetwork(page *rod.Page) func() {
+	if w.NetworkIdle <= 0 {
+		return func() {}
+	}
+	// unlike rod's default, images and fonts count: they are what gets cut off
+	return page.WaitRequestIdle(w.NetworkIdle, nil, nil, []proto.NetworkResourceType{
+		proto.NetworkResourceTypeWebSocket,
+		proto.NetworkResourceTypeEventSource,
+		proto.NetworkResourceTypeMedia,
+	})
+}
+
+// waitForPage runs the waits of w on page, which must have been bound to
+// ctx, after the content is set.
+func waitForPage(ctx context.Context, page *rod.Page, w WaitOptions, networkIdle func()) error {
+	step := func(name string, err error) error {
+		// rod's own error hides a timeout, report it as such
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("error waiting for %s: %w", name, err)
+		}
+		return nil
+	}
+
+	switch w.Until {
+	case WaitUntilLoad:
+		if err := step("page load", page.WaitLoad()); err != nil {
+			return err
+		}
+	case WaitUntilDOMContentLoaded:
+		_, err := page.Evaluate(rod.Eval(`() => document.readyState !== 'loading' ||
+			new Promise(r => document.addEventListener('DOMContentLoaded', () => r(true)))`).ByPromise())
+		if err := step("DOMContentLoaded", err); err != nil {
+			return err
+		}
+	}
+
+	// returns early without an error if ctx is done
+	networkIdle()
+	if err := step("network idle", nil); err != nil {
+		return err
+	}
+
+	if w.Fonts {
+		_, err := page.Evaluate(rod.Eval(`() => document.fonts.ready.then(() => true)`).ByPromise())
+		if err := step("fonts", err); err != nil {
+			return err
+		}
+	}
+
+	if w.Selector != "" {
+		_, err := page.Element(w.Selector)
+		if err := step("selector "+w.Selector, err); err != nil {
+			return err
+		}
+	}
+
+	if w.ReadyFlag {
+		err := page.Wait(rod.Eval(`() => window.espressoReady === true`))
+		if err := step("window.espressoReady", err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateWaitOptions(t *testing.T) {
+	w, err := templateWaitOptions(`<html><head>
+		<meta name="espresso-wait" content="load; network-idle=500ms; selector=#chart &gt; svg; ready; fonts; timeout=15s">
+	</head></html>`)
+	assert.NoError(t, err)
+	assert.Equal(t, WaitOptions{
+		Until:       WaitUntilLoad,
+		NetworkIdle: 500 * time.Millisecond,
+		Selector:    "#chart > svg",
+		ReadyFlag:   true,
+		Fonts:       true,
+		Timeout:     15 * time.Second,
+	}, w)
+
+	w, err = templateWaitOptions(`<html><body>no meta tag</body></html>`)
+	assert.NoError(t, err)
+	assert.False(t, w.any())
+
+	_, err = templateWaitOptions(`<meta name='espresso-wait' content='idle'>`)
+	assert.ErrorContains(t, err, `unknown option "idle"`)
+}
+
+func TestWaitOptionsMerge(t *testing.T) {
+	template := WaitOptions{Until: WaitUntilLoad, Selector: "#chart", Timeout: 15 * time.Second}
+
+	w := template.merge(&WaitOptions{Until: WaitUntilDOMContentLoaded, ReadyFlag: true})
+	assert.Equal(t, WaitOptions{Until: WaitUntilDOMContentLoaded, Selector: "#chart", ReadyFlag: true, Timeout: 15 * time.Second}, w)
+	assert.Equal(t, template, template.merge(nil))
+}
@@ -0,0 +1,72 @@
+package templatestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrAssetNotFound is returned by GetAsset when the template has no asset at
+// the requested path.
+var ErrAssetNotFound = errors.New("asset not found")
+
+// AssetStore is implemented by storage adapters that can keep assets (CSS,
+// fonts, images) next to their templates. Renders of a template served by an
+// AssetStore fetch its assets from the store instead of the network.
+type AssetStore interface {
+	GetAsset(ctx context.Context, req *GetAssetRequest) (*Asset, error)
+
+	PutAsset(ctx context.Context, req *PutAssetRequest) error
+}
+
+type GetAssetRequest struct {
+	Template GetTemplateRequest
+	// Path is relative to the template, e.g. css/invoice.css.
+	Path string
+}
+
+type PutAssetRequest struct {
+	Template GetTemplateRequest
+	Path     string
+	Content  []byte
+	// ContentType is detected from Path, then Content, when empty.
+	ContentType string
+}
+
+type Asset struct {
+	Content     []byte
+	ContentType string
+}
+
+// assetDir is the directory, next to a template, that the disk and S3
+// adapters keep its assets in. Keeping them apart stops an asset from
+// replacing, or being served as, the template or one of its siblings.
+const assetDir = "assets"
+
+// CleanAssetPath normalises an asset path relative to its template and
+// rejects paths that would escape the template's directory.
+func CleanAssetPath(p string) (string, error) {
+	p = strings.TrimPrefix(strings.ReplaceAll(p, "\\", "/"), "/")
+	if p == "" {
+		return "", fmt.Errorf("asset path is required")
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("asset path %q escapes the template directory", p)
+		}
+	}
+	return path.Clean(p), nil
+}
+
+// assetContentType picks the content type of an asset from its extension,
+// falling back to sniffing its content.
+func assetContentType(p string, content []byte) string {
+	if t := mime.TypeByExtension(path.Ext(p)); t != "" {
+		return t
+	}
+	return http.DetectContentType(content)
+}
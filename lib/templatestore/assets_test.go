@@ -0,0 +1,37 @@
+package templatestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskAssetsStayOutOfTemplates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	template := GetTemplateRequest{TemplatePath: filepath.Join(dir, "a.html")}
+	require.NoError(t, os.WriteFile(template.TemplatePath, []byte("template a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.html"), []byte("template b"), 0644))
+
+	store := &DiskTemplateStorage{}
+	for _, name := range []string{"a.html", "b.html"} {
+		require.NoError(t, store.PutAsset(ctx, &PutAssetRequest{Template: template, Path: name, Content: []byte("asset")}))
+	}
+	for name, want := range map[string]string{"a.html": "template a", "b.html": "template b", "assets/a.html": "asset", "assets/b.html": "asset"} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), name)
+	}
+
+	// a sibling template is not served as an asset of the template
+	require.NoError(t, os.Remove(filepath.Join(dir, "assets", "b.html")))
+	_, err := store.GetAsset(ctx, &GetAssetRequest{Template: template, Path: "b.html"})
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+	asset, err := store.GetAsset(ctx, &GetAssetRequest{Template: template, Path: "./a.html"})
+	require.NoError(t, err)
+	assert.Equal(t, "asset", string(asset.Content))
+}
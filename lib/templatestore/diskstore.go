@@ -2,8 +2,10 @@ package templatestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"text/template"
@@ -20,7 +22,7 @@ func (d *DiskTemplateStorage) GetTemplate(ctx context.Context, req *GetTemplateR
 	}
 	// get template from filepath
 	templatePath := req.TemplatePath
-	templateFile, err := template.ParseFiles(templatePath)
+	templateFile, err := template.New(filepath.Base(templatePath)).Funcs(Funcs()).ParseFiles(templatePath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse template file: %v", err)
 	}
@@ -62,7 +64,7 @@ func (d *DiskTemplateStorage) GetDocument(ctx context.Context, req *GetDocumentR
 	// Open the file for reading
 	file, err := os.Open(req.FilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	return file, nil
@@ -78,3 +80,45 @@ func (m *DiskTemplateStorage) GetTemplateContent(ctx context.Context, req *GetTe
 func (m *DiskTemplateStorage) CreateTemplate(ctx context.Context, req *CreateTemplateRequest) (string, error) {
 	return "", fmt.Errorf("create template not implemented for disk storage")
 }
+
+// GetAsset reads an asset from the assets directory next to the template.
+func (d *DiskTemplateStorage) GetAsset(ctx context.Context, req *GetAssetRequest) (*Asset, error) {
+	file, err := diskAssetPath(&req.Template, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, fmt.Errorf("failed to read asset: %v", err)
+	}
+	return &Asset{Content: content, ContentType: assetContentType(file, content)}, nil
+}
+
+// PutAsset writes an asset to the assets directory next to the template.
+func (d *DiskTemplateStorage) PutAsset(ctx context.Context, req *PutAssetRequest) error {
+	file, err := diskAssetPath(&req.Template, req.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(file, req.Content, 0644); err != nil {
+		return fmt.Errorf("failed to write asset: %v", err)
+	}
+	return nil
+}
+
+func diskAssetPath(template *GetTemplateRequest, assetPath string) (string, error) {
+	if template.TemplatePath == "" {
+		return "", fmt.Errorf("template path is required for disk storage")
+	}
+	clean, err := CleanAssetPath(assetPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(template.TemplatePath), assetDir, filepath.FromSlash(clean)), nil
+}
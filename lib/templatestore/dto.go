@@ -31,9 +31,10 @@ type GetTemplateContentRequest struct {
 	TemplateUUID string
 }
 type GetTemplateContentResponse struct {
-	TemplateContent    string `json:"template_content"`
-	TemplateName       string `json:"template_name,omitempty"`
-	TemplateJsonSchema string `json:"template_json_schema,omitempty"`
+	TemplateContent    string    `json:"template_content"`
+	TemplateName       string    `json:"template_name,omitempty"`
+	TemplateJsonSchema string    `json:"template_json_schema,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at,omitempty"`
 }
 type CreateTemplateRequest struct {
 	TemplateName string
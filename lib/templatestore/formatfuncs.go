@@ -0,0 +1,382 @@
+package templatestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// numberLocale is how a locale writes numbers.
+type numberLocale struct {
+	group   string
+	decimal string
+	// indian groups digits by lakh and crore: 12,34,56,789
+	indian bool
+	// symbolAfter writes currency symbols after the amount: 1.234,50 €
+	symbolAfter bool
+}
+
+var numberLocales = map[string]numberLocale{
+	"en":    {group: ",", decimal: "."},
+	"en-us": {group: ",", decimal: "."},
+	"en-gb": {group: ",", decimal: "."},
+	"en-ae": {group: ",", decimal: "."},
+	"en-sg": {group: ",", decimal: "."},
+	"en-au": {group: ",", decimal: "."},
+	"en-in": {group: ",", decimal: ".", indian: true},
+	"hi":    {group: ",", decimal: ".", indian: true},
+	"hi-in": {group: ",", decimal: ".", indian: true},
+	"de":    {group: ".", decimal: ",", symbolAfter: true},
+	"de-de": {group: ".", decimal: ",", symbolAfter: true},
+	"es":    {group: ".", decimal: ",", symbolAfter: true},
+	"es-es": {group: ".", decimal: ",", symbolAfter: true},
+	"fr":    {group: "\u202f", decimal: ",", symbolAfter: true},
+	"fr-fr": {group: "\u202f", decimal: ",", symbolAfter: true},
+}
+
+// currency is how amounts in a currency are written, and named in words.
+type currency struct {
+	symbol   string
+	decimals int
+	// locale is the one formatCurrency writes the currency in
+	locale            string
+	unit, units       string
+	subunit, subunits string
+}
+
+var currencies = map[string]currency{
+	"INR": {symbol: "₹", decimals: 2, locale: "en-in", unit: "Rupee", units: "Rupees", subunit: "Paisa", subunits: "Paise"},
+	"USD": {symbol: "$", decimals: 2, locale: "en-us", unit: "Dollar", units: "Dollars", subunit: "Cent", subunits: "Cents"},
+	"EUR": {symbol: "€", decimals: 2, locale: "en", unit: "Euro", units: "Euros", subunit: "Cent", subunits: "Cents"},
+	"GBP": {symbol: "£", decimals: 2, locale: "en-gb", unit: "Pound", units: "Pounds", subunit: "Penny", subunits: "Pence"},
+	"AED": {symbol: "AED ", decimals: 2, locale: "en-ae", unit: "Dirham", units: "Dirhams", subunit: "Fil", subunits: "Fils"},
+	"SGD": {symbol: "S$", decimals: 2, locale: "en-sg", unit: "Dollar", units: "Dollars", subunit: "Cent", subunits: "Cents"},
+	"AUD": {symbol: "A$", decimals: 2, locale: "en-au", unit: "Dollar", units: "Dollars", subunit: "Cent", subunits: "Cents"},
+	"JPY": {symbol: "¥", decimals: 0, locale: "en", unit: "Yen", units: "Yen"},
+}
+
+func lookupLocale(name string) (numberLocale, error) {
+	key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", "-"))
+	if l, ok := numberLocales[key]; ok {
+		return l, nil
+	}
+	language, _, _ := strings.Cut(key, "-")
+	if l, ok := numberLocales[language]; ok {
+		return l, nil
+	}
+	return numberLocale{}, fmt.Errorf("unsupported locale %q", name)
+}
+
+// lookupCurrency returns a currency by its ISO 4217 code. Codes without an
+// entry are written with the code as their symbol and cannot be spelled out.
+func lookupCurrency(code string) (currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if c, ok := currencies[code]; ok {
+		return c, nil
+	}
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return currency{}, fmt.Errorf("unsupported currency %q", code)
+	}
+	return currency{symbol: code + " ", decimals: 2, locale: "en"}, nil
+}
+
+// decimalDigits returns the digits of |x| before and after the decimal point,
+// rounded half away from zero at places decimals as x is written in decimal.
+func decimalDigits(x float64, places int) (string, string) {
+	places = max(places, 0)
+	whole, frac, _ := strings.Cut(strconv.FormatFloat(math.Abs(x), 'f', -1, 64), ".")
+	if len(frac) > places {
+		roundUp := frac[places] >= '5'
+		frac = frac[:places]
+		if roundUp {
+			digits := []byte(whole + frac)
+			i := len(digits) - 1
+			for ; i >= 0 && digits[i] == '9'; i-- {
+				digits[i] = '0'
+			}
+			if i >= 0 {
+				digits[i]++
+			} else {
+				digits = append([]byte{'1'}, digits...)
+			}
+			whole, frac = string(digits[:len(digits)-places]), string(digits[len(digits)-places:])
+		}
+	}
+	return whole, frac + strings.Repeat("0", places-len(frac))
+}
+
+// formatDecimal writes x with decimals decimals in a locale, without a sign.
+// It reports whether x is negative once rounded.
+func formatDecimal(x float64, decimals int, l numberLocale) (string, bool) {
+	whole, frac := decimalDigits(x, decimals)
+	negative := x < 0 && strings.Trim(whole+frac, "0") != ""
+
+	var groups []string
+	size := 3
+	for len(whole) > size {
+		groups = append([]string{whole[len(whole)-size:]}, groups...)
+		whole = whole[:len(whole)-size]
+		if l.indian {
+			size = 2
+		}
+	}
+	groups = append([]string{whole}, groups...)
+
+	out := strings.Join(groups, l.group)
+	if frac != "" {
+		out += l.decimal + frac
+	}
+	return out, negative
+}
+
+// formatNumber writes a number with thousands separators: {{.qty |
+// formatNumber 2}} is 1,234.50.
+func formatNumber(decimals int, v any) (string, error) {
+	return formatNumberIn("en", decimals, v)
+}
+
+// formatNumberIn writes a number the way a locale does: {{formatNumberIn
+// "en-IN" 0 .population}} is 12,34,56,789.
+func formatNumberIn(locale string, decimals int, v any) (string, error) {
+	l, err := lookupLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	x, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	out, negative := formatDecimal(x, decimals, l)
+	if negative {
+		out = "-" + out
+	}
+	return out, nil
+}
+
+// formatCurrency writes an amount in a currency the way its country does:
+// {{.total | formatCurrency "INR"}} is ₹12,34,567.50.
+func formatCurrency(code string, v any) (string, error) {
+	c, err := lookupCurrency(code)
+	if err != nil {
+		return "", err
+	}
+	return formatCurrencyIn(c.locale, code, v)
+}
+
+// formatCurrencyIn writes an amount in a currency the way a locale does:
+// {{formatCurrencyIn "de-DE" "EUR" .total}} is 1.234,50 €.
+func formatCurrencyIn(locale, code string, v any) (string, error) {
+	l, err := lookupLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	c, err := lookupCurrency(code)
+	if err != nil {
+		return "", err
+	}
+	x, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	out, negative := formatDecimal(x, c.decimals, l)
+	if l.symbolAfter {
+		out += " " + strings.TrimSpace(c.symbol)
+	} else {
+		out = c.symbol + out
+	}
+	if negative {
+		out = "-" + out
+	}
+	return out, nil
+}
+
+// maxAmountInWords keeps amounts below where float64 loses paise.
+const maxAmountInWords = 1e15
+
+// amountInWords spells out an amount, in lakh and crore for INR: {{.total |
+// amountInWords "INR"}} is Twelve Lakh Thirty Four Thousand Five Hundred
+// Sixty Seven Rupees and Fifty Paise.
+func amountInWords(code string, v any) (string, error) {
+	c, err := lookupCurrency(code)
+	if err != nil {
+		return "", err
+	}
+	if c.unit == "" {
+		return "", fmt.Errorf("amountInWords: no words for currency %q", code)
+	}
+	l, err := lookupLocale(c.locale)
+	if err != nil {
+		return "", err
+	}
+	x, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(x) >= maxAmountInWords || math.IsNaN(x) {
+		return "", fmt.Errorf("amountInWords: %v is out of range", x)
+	}
+
+	whole, frac := decimalDigits(x, c.decimals)
+	units, _ := strconv.ParseInt(whole, 10, 64)
+	subunits, _ := strconv.ParseInt("0"+frac, 10, 64)
+
+	out := spellNumber(units, l.indian) + " " + pluralForm(units, c.unit, c.units)
+	if subunits > 0 {
+		out += " and " + spellNumber(subunits, l.indian) + " " + pluralForm(subunits, c.subunit, c.subunits)
+	}
+	if x < 0 && units+subunits > 0 {
+		out = "Minus " + out
+	}
+	return out, nil
+}
+
+var (
+	smallNumberWords = []string{"Zero", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten",
+		"Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	tensWords = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+type numberScale struct {
+	size int64
+	name string
+}
+
+var (
+	indianScales        = []numberScale{{1e7, "Crore"}, {1e5, "Lakh"}, {1e3, "Thousand"}}
+	internationalScales = []numberScale{{1e12, "Trillion"}, {1e9, "Billion"}, {1e6, "Million"}, {1e3, "Thousand"}}
+)
+
+// spellNumber spells out n >= 0. Counts of crores above 99 are spelled out
+// themselves, as in One Lakh Crore.
+func spellNumber(n int64, indian bool) string {
+	if n == 0 {
+		return smallNumberWords[0]
+	}
+	scales := internationalScales
+	if indian {
+		scales = indianScales
+	}
+	var words []string
+	for _, scale := range scales {
+		if n >= scale.size {
+			words = append(words, spellNumber(n/scale.size, indian), scale.name)
+			n %= scale.size
+		}
+	}
+	if n >= 100 {
+		words = append(words, smallNumberWords[n/100], "Hundred")
+		n %= 100
+	}
+	if n >= 20 {
+		words = append(words, tensWords[n/10])
+		n %= 10
+	}
+	if n > 0 {
+		words = append(words, smallNumberWords[n])
+	}
+	return strings.Join(words, " ")
+}
+
+func pluralForm(n int64, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// pluralize returns singular for a count of 1, and plural, or singular with
+// an s, otherwise: {{.n}} {{pluralize .n "item"}}.
+func pluralize(count any, singular string, plural ...string) (string, error) {
+	n, err := toFloat(count)
+	if err != nil {
+		return "", err
+	}
+	if n == 1 {
+		return singular, nil
+	}
+	if len(plural) > 0 {
+		return plural[0], nil
+	}
+	return singular + "s", nil
+}
+
+// dateLayouts are names formatDate takes for common layouts, besides Go
+// layouts such as "02 Jan 2006".
+var dateLayouts = map[string]string{
+	"date":     "02 Jan 2006",
+	"datetime": "02 Jan 2006 15:04",
+	"time":     "15:04",
+	"iso":      "2006-01-02",
+	"rfc3339":  time.RFC3339,
+}
+
+// formatDate writes a date in a layout: {{.created_at | formatDate
+// "02 Jan 2006"}}. Dates are time.Time values, RFC 3339 strings, or
+// dates and times without an offset, which are taken to be UTC, or Unix
+// timestamps in seconds.
+func formatDate(layout string, v any) (string, error) {
+	t, err := toTime(v, nil)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(dateLayout(layout)), nil
+}
+
+// formatDateIn writes a date in a time zone: {{formatDateIn "Asia/Kolkata"
+// "datetime" .paid_at}}. Dates without an offset are taken to be in it.
+func formatDateIn(zone, layout string, v any) (string, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", fmt.Errorf("formatDateIn: unknown time zone %q", zone)
+	}
+	t, err := toTime(v, loc)
+	if err != nil {
+		return "", err
+	}
+	return t.In(loc).Format(dateLayout(layout)), nil
+}
+
+func dateLayout(layout string) string {
+	if named, ok := dateLayouts[layout]; ok {
+		return named
+	}
+	return layout
+}
+
+// toTime reads a date, taking dates without an offset to be in loc, or UTC
+// if loc is nil.
+func toTime(v any, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	case string:
+		s := strings.TrimSpace(t)
+		if parsed, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return parsed, nil
+		}
+		for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if parsed, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("expected a date, got %q", t)
+	case int, int32, int64, uint, uint32, uint64, float32, float64, json.Number:
+		seconds, err := toFloat(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)).In(loc), nil
+	}
+	return time.Time{}, fmt.Errorf("expected a date, got %T", v)
+}
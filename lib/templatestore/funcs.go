@@ -0,0 +1,310 @@
+package templatestore
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	customFuncsMu sync.RWMutex
+	customFuncs   = template.FuncMap{}
+)
+
+// Funcs returns the functions every template is parsed with, whichever store
+// parses it: the built-in library below and the functions added with
+// RegisterFuncs.
+//
+// Functions that take the value a pipeline passes in take it last, so
+// {{.total | formatCurrency "INR"}} and {{formatCurrency "INR" .total}}
+// are the same.
+//
+// safeHTML, safeURL, safeCSS and safeJS mark a value as trusted for
+// templates rendered with html escaping, so it is written as it is. They do
+// nothing in text mode. Only use them on content the caller controls.
+func Funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"safeHTML": func(v any) htmltemplate.HTML { return htmltemplate.HTML(stringValue(v)) },
+		"safeURL":  func(v any) htmltemplate.URL { return htmltemplate.URL(stringValue(v)) },
+		"safeCSS":  func(v any) htmltemplate.CSS { return htmltemplate.CSS(stringValue(v)) },
+		"safeJS":   func(v any) htmltemplate.JS { return htmltemplate.JS(stringValue(v)) },
+
+		"formatNumber":     formatNumber,
+		"formatNumberIn":   formatNumberIn,
+		"formatCurrency":   formatCurrency,
+		"formatCurrencyIn": formatCurrencyIn,
+		"amountInWords":    amountInWords,
+		"formatDate":       formatDate,
+		"formatDateIn":     formatDateIn,
+		"pluralize":        pluralize,
+
+		"upper":     func(v any) string { return strings.ToUpper(stringValue(v)) },
+		"lower":     func(v any) string { return strings.ToLower(stringValue(v)) },
+		"title":     title,
+		"trim":      func(v any) string { return strings.TrimSpace(stringValue(v)) },
+		"truncate":  truncate,
+		"replace":   func(old, new string, v any) string { return strings.ReplaceAll(stringValue(v), old, new) },
+		"contains":  func(substr string, v any) bool { return strings.Contains(stringValue(v), substr) },
+		"hasPrefix": func(prefix string, v any) bool { return strings.HasPrefix(stringValue(v), prefix) },
+		"hasSuffix": func(suffix string, v any) bool { return strings.HasSuffix(stringValue(v), suffix) },
+		"split":     func(sep string, v any) []string { return strings.Split(stringValue(v), sep) },
+		"join":      join,
+
+		"add":   func(a, b any) (float64, error) { return arith(a, b, func(x, y float64) float64 { return x + y }) },
+		"sub":   func(a, b any) (float64, error) { return arith(a, b, func(x, y float64) float64 { return x - y }) },
+		"mul":   func(a, b any) (float64, error) { return arith(a, b, func(x, y float64) float64 { return x * y }) },
+		"div":   div,
+		"mod":   mod,
+		"round": round,
+		"floor": func(v any) (float64, error) { return apply(v, math.Floor) },
+		"ceil":  func(v any) (float64, error) { return apply(v, math.Ceil) },
+		"abs":   func(v any) (float64, error) { return apply(v, math.Abs) },
+		"min":   func(a any, rest ...any) (float64, error) { return fold(math.Min, a, rest) },
+		"max":   func(a any, rest ...any) (float64, error) { return fold(math.Max, a, rest) },
+
+		"default": defaultValue,
+		"dict":    dict,
+		"list":    func(values ...any) []any { return values },
+		"toJSON":  toJSON,
+	}
+
+	customFuncsMu.RLock()
+	defer customFuncsMu.RUnlock()
+	for name, fn := range customFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// RegisterFuncs adds functions to every template parsed from now on, e.g.
+// for GST codes or a team's own date formats. A function with the name of a
+// built-in one replaces it. Register them before templates are parsed,
+// typically at startup: templates parsed earlier do not see them.
+func RegisterFuncs(funcs template.FuncMap) (err error) {
+	// text/template panics on names and signatures it cannot call
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid template functions: %v", r)
+		}
+	}()
+	template.New("").Funcs(funcs)
+
+	customFuncsMu.Lock()
+	defer customFuncsMu.Unlock()
+	for name, fn := range funcs {
+		customFuncs[name] = fn
+	}
+	return nil
+}
+
+func stringValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// toFloat converts numbers, and strings and JSON numbers holding one, for
+// the math and formatting functions. A missing value is an error rather
+// than zero, so a misspelled key does not print an amount of 0.
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, fmt.Errorf("expected a number, got no value")
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case uint:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case uint32:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number, got %q", n)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func title(v any) string {
+	words := strings.Fields(stringValue(v))
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// truncate shortens a value to n characters, the last of them an ellipsis.
+func truncate(n int, v any) string {
+	runes := []rune(stringValue(v))
+	if n <= 0 {
+		return ""
+	}
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+func join(sep string, v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	list := reflect.ValueOf(v)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", v)
+	}
+	parts := make([]string, list.Len())
+	for i := range parts {
+		parts[i] = stringValue(list.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func arith(a, b any, op func(x, y float64) float64) (float64, error) {
+	x, err := toFloat(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	return op(x, y), nil
+}
+
+func div(a, b any) (float64, error) {
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("div: division by zero")
+	}
+	return arith(a, y, func(x, y float64) float64 { return x / y })
+}
+
+func mod(a, b any) (int64, error) {
+	x, err := toFloat(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	if int64(y) == 0 {
+		return 0, fmt.Errorf("mod: division by zero")
+	}
+	return int64(x) % int64(y), nil
+}
+
+// round rounds half away from zero at places decimals, as written in
+// decimal, so 2.675 rounds to 2.68.
+func round(places int, v any) (float64, error) {
+	x, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	whole, frac := decimalDigits(x, places)
+	rounded, err := strconv.ParseFloat(whole+"."+frac, 64)
+	if err != nil {
+		return 0, err
+	}
+	if x < 0 {
+		rounded = -rounded
+	}
+	return rounded, nil
+}
+
+func apply(v any, fn func(float64) float64) (float64, error) {
+	x, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	return fn(x), nil
+}
+
+func fold(fn func(x, y float64) float64, first any, rest []any) (float64, error) {
+	result, err := toFloat(first)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range rest {
+		x, err := toFloat(v)
+		if err != nil {
+			return 0, err
+		}
+		result = fn(result, x)
+	}
+	return result, nil
+}
+
+// defaultValue returns v, or def if v is missing, zero or empty:
+// {{.gstin | default "N/A"}}.
+func defaultValue(def, v any) any {
+	if v == nil {
+		return def
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if value.Len() == 0 {
+			return def
+		}
+	default:
+		if value.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+// dict builds a map from key and value pairs, e.g. to pass several values to
+// a nested template: {{template "row" dict "label" "Total" "amount" .total}}.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected key and value pairs, got %d arguments", len(pairs))
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is a %T, not a string", pairs[i], pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// toJSON encodes a value as JSON that is safe inside a script element: <, >
+// and & are escaped, so a value cannot close the element.
+func toJSON(v any) (htmltemplate.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("toJSON: %v", err)
+	}
+	return htmltemplate.JS(b), nil
+}
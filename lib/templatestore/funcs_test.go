@@ -0,0 +1,95 @@
+package templatestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"total":    1234567.5,
+		"crores":   json.Number("1234567890"),
+		"neg":      -0.004,
+		"qty":      1,
+		"items":    []string{"tea", "coffee"},
+		"paid_at":  "2024-03-31T20:00:00Z",
+		"due":      "2024-04-15",
+		"unix":     1711915200,
+		"note":     "",
+		"customer": "<b>Ravi & Co</b>",
+	}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{{.total | formatCurrency "INR"}}`, "₹12,34,567.50"},
+		{`{{formatNumberIn "en-IN" 0 .crores}}`, "1,23,45,67,890"},
+		{`{{formatNumber 2 .total}}`, "1,234,567.50"},
+		{`{{formatCurrencyIn "de-DE" "EUR" .total}}`, "1.234.567,50 €"},
+		{`{{formatCurrency "USD" -2.675}}`, "-$2.68"},
+		{`{{formatCurrency "JPY" 1500.5}}`, "¥1,501"},
+		{`{{formatCurrency "XYZ" 10}}`, "XYZ 10.00"},
+		{`{{formatNumber 2 .neg}}`, "0.00"},
+		{`{{.total | amountInWords "INR"}}`, "Twelve Lakh Thirty Four Thousand Five Hundred Sixty Seven Rupees and Fifty Paise"},
+		{`{{amountInWords "INR" .crores}}`, "One Hundred Twenty Three Crore Forty Five Lakh Sixty Seven Thousand Eight Hundred Ninety Rupees"},
+		{`{{amountInWords "USD" 1000001.01}}`, "One Million One Dollars and One Cent"},
+		{`{{amountInWords "GBP" 1}}`, "One Pound"},
+		{`{{formatDate "date" .paid_at}}`, "31 Mar 2024"},
+		{`{{formatDateIn "Asia/Kolkata" "datetime" .paid_at}}`, "01 Apr 2024 01:30"},
+		{`{{formatDateIn "Asia/Kolkata" "rfc3339" .due}}`, "2024-04-15T00:00:00+05:30"},
+		{`{{.unix | formatDate "iso"}}`, "2024-03-31"},
+		{`{{.qty}} {{pluralize .qty "item"}}, {{len .items}} {{pluralize (len .items) "box" "boxes"}}`, "1 item, 2 boxes"},
+		{`{{.customer | upper}} {{title "ravi kumar"}} {{truncate 5 "Espresso"}} {{replace "-" "/" "a-b"}}`, "<B>RAVI & CO</B> Ravi Kumar Espr… a/b"},
+		{`{{join ", " .items}} {{index (split "," "a,b") 1}} {{if contains "cof" "coffee"}}yes{{end}}`, "tea, coffee b yes"},
+		{`{{add 1 2}} {{sub 5 .qty}} {{mul "1.5" 2}} {{div 7 2}} {{mod 7 3}} {{round 2 2.675}} {{max 3 9 4}} {{abs -2}}`, "3 4 3 3.5 1 2.68 9 2"},
+		{`{{.note | default "N/A"}} {{.missing | default "-"}} {{.qty | default 5}}`, "N/A - 1"},
+		{`{{with dict "name" "Ravi" "tags" (list 1 "two")}}{{.name}} {{index .tags 1}}{{end}}`, "Ravi two"},
+		{`{{toJSON .customer}} {{toJSON (list 1 "a")}}`, `"\u003cb\u003eRavi \u0026 Co\u003c/b\u003e" [1,"a"]`},
+	}
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(Funcs()).Parse(tt.template)
+		require.NoError(t, err, tt.template)
+		var out bytes.Buffer
+		require.NoError(t, tmpl.Execute(&out, data), tt.template)
+		assert.Equal(t, tt.want, out.String(), tt.template)
+	}
+
+	for _, broken := range []string{
+		`{{formatCurrency "INR" .missing}}`,
+		`{{formatNumberIn "xx" 2 1}}`,
+		`{{div 1 0}}`,
+		`{{dict "a"}}`,
+		`{{formatDateIn "Mars/Base" "date" .due}}`,
+		`{{amountInWords "XYZ" 1}}`,
+	} {
+		tmpl, err := template.New("test").Funcs(Funcs()).Parse(broken)
+		require.NoError(t, err, broken)
+		assert.Error(t, tmpl.Execute(&bytes.Buffer{}, data), broken)
+	}
+}
+
+func TestRegisterFuncs(t *testing.T) {
+	t.Cleanup(func() {
+		customFuncsMu.Lock()
+		customFuncs = template.FuncMap{}
+		customFuncsMu.Unlock()
+	})
+
+	require.NoError(t, RegisterFuncs(template.FuncMap{
+		"gstState": func(gstin string) string { return gstin[:2] },
+		"upper":    func(v any) string { return "replaced" },
+	}))
+	assert.ErrorContains(t, RegisterFuncs(template.FuncMap{"bad name": func() string { return "" }}), "invalid template functions")
+	assert.ErrorContains(t, RegisterFuncs(template.FuncMap{"noResult": func() {}}), "invalid template functions")
+
+	tmpl, err := template.New("test").Funcs(Funcs()).Parse(`{{gstState "29ABCDE1234F1Z5"}} {{upper "x"}} {{formatNumber 0 1000}}`)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, tmpl.Execute(&out, nil))
+	assert.Equal(t, "29 replaced 1,000", out.String())
+}
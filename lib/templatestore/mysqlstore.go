@@ -122,7 +122,7 @@ func (m *MySQLTemplateStorage) GetTemplate(ctx context.Context, req *GetTemplate
 		return nil, fmt.Errorf("error retrieving template: %v", err)
 	}
 
-	return template.New("template" + templateID).Parse(templateContent)
+	return template.New("template" + templateID).Funcs(Funcs()).Parse(templateContent)
 }
 
 // PutDocument stores a document in MySQL.
@@ -175,11 +175,12 @@ func (m *MySQLTemplateStorage) ListTemplates(ctx context.Context) ([]*TemplateIn
 func (m *MySQLTemplateStorage) GetTemplateContent(ctx context.Context, req *GetTemplateContentRequest) (*GetTemplateContentResponse, error) {
 	// Query template info from database
 	var templateContent, templateName, jsonSchema string
+	var updatedAt sql.NullTime
 	templateId := req.TemplateUUID
 	// First get the template content
 	err := m.DB.QueryRowContext(ctx,
-		"SELECT template_content, template_name,json_schema FROM templates WHERE template_id = ?",
-		templateId).Scan(&templateContent, &templateName, &jsonSchema)
+		"SELECT template_content, template_name, json_schema, updated_at FROM templates WHERE template_id = ?",
+		templateId).Scan(&templateContent, &templateName, &jsonSchema, &updatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -192,6 +193,7 @@ func (m *MySQLTemplateStorage) GetTemplateContent(ctx context.Context, req *GetT
 		TemplateContent:    templateContent,
 		TemplateName:       templateName,
 		TemplateJsonSchema: jsonSchema,
+		UpdatedAt:          updatedAt.Time,
 	}
 
 	return resp, nil
@@ -225,6 +227,70 @@ func (m *MySQLTemplateStorage) CreateTemplate(ctx context.Context, req *CreateTe
 	return templateID, nil
 }
 
+// GetAsset retrieves an asset of a template from the template_assets table.
+func (m *MySQLTemplateStorage) GetAsset(ctx context.Context, req *GetAssetRequest) (*Asset, error) {
+	if req.Template.TemplateUUID == "" {
+		return nil, fmt.Errorf("template UUID is required for MySQL storage")
+	}
+	assetPath, err := CleanAssetPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	asset := &Asset{}
+	err = m.DB.QueryRowContext(ctx,
+		"SELECT content, content_type FROM template_assets WHERE template_id = ? AND path = ?",
+		req.Template.TemplateUUID, assetPath).Scan(&asset.Content, &asset.ContentType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAssetNotFound
+		}
+		return nil, fmt.Errorf("error retrieving asset: %v", err)
+	}
+	return asset, nil
+}
+
+// PutAsset stores an asset of a template, replacing any asset at the same
+// path. The template's updated_at is bumped so renders cached with the old
+// asset are not served.
+func (m *MySQLTemplateStorage) PutAsset(ctx context.Context, req *PutAssetRequest) error {
+	if req.Template.TemplateUUID == "" {
+		return fmt.Errorf("template UUID is required for MySQL storage")
+	}
+	assetPath, err := CleanAssetPath(req.Path)
+	if err != nil {
+		return err
+	}
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = assetContentType(assetPath, req.Content)
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE templates SET updated_at = CURRENT_TIMESTAMP WHERE template_id = ?", req.Template.TemplateUUID)
+	if err != nil {
+		return fmt.Errorf("error updating template: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("template not found: %s", req.Template.TemplateUUID)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO template_assets (template_id, path, content_type, content) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE content_type = VALUES(content_type), content = VALUES(content)`,
+		req.Template.TemplateUUID, assetPath, contentType, req.Content)
+	if err != nil {
+		return fmt.Errorf("error inserting asset into database: %v", err)
+	}
+	return tx.Commit()
+}
+
 // Close closes the database connection.
 func (m *MySQLTemplateStorage) Close() error {
 	if m.DB != nil {
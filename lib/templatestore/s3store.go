@@ -1,12 +1,16 @@
 package templatestore
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"path"
 	"text/template"
 
 	"github.com/Zomato/espresso/lib/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type S3TemplateStorage struct {
@@ -33,7 +37,7 @@ func (s *S3TemplateStorage) GetTemplate(ctx context.Context, req *GetTemplateReq
 	if err != nil {
 		return nil, err
 	}
-	return template.New("template").Parse(string(templateData))
+	return template.New("template").Funcs(Funcs()).Parse(string(templateData))
 }
 
 func (s *S3TemplateStorage) PutDocument(ctx context.Context, req *PostDocumentRequest, reader *io.Reader) (string, error) {
@@ -65,3 +69,61 @@ func (m *S3TemplateStorage) GetTemplateContent(ctx context.Context, req *GetTemp
 func (m *S3TemplateStorage) CreateTemplate(ctx context.Context, req *CreateTemplateRequest) (string, error) {
 	return "", fmt.Errorf("create template not implemented for S3 storage")
 }
+
+// GetPresignedURL returns a time-limited GET URL for a document previously
+// stored with PutDocument.
+func (s *S3TemplateStorage) GetPresignedURL(ctx context.Context, key string, expirySeconds int) (string, error) {
+	presign, err := s.client.GetPresignURL(ctx, key, expirySeconds)
+	if err != nil {
+		return "", err
+	}
+	return presign.URL, nil
+}
+
+// GetAsset reads an asset stored under the assets prefix next to the
+// template.
+func (s *S3TemplateStorage) GetAsset(ctx context.Context, req *GetAssetRequest) (*Asset, error) {
+	key, err := s3AssetKey(&req.Template, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := s.client.GetFileReader(ctx, key)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, fmt.Errorf("failed to get asset from S3: %v", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset from S3: %v", err)
+	}
+	return &Asset{Content: content, ContentType: assetContentType(key, content)}, nil
+}
+
+// PutAsset uploads an asset under the assets prefix next to the template.
+func (s *S3TemplateStorage) PutAsset(ctx context.Context, req *PutAssetRequest) error {
+	key, err := s3AssetKey(&req.Template, req.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.UploadFile(ctx, key, bytes.NewReader(req.Content)); err != nil {
+		return fmt.Errorf("failed to upload asset to S3: %v", err)
+	}
+	return nil
+}
+
+func s3AssetKey(template *GetTemplateRequest, assetPath string) (string, error) {
+	if template.TemplateS3Path == "" {
+		return "", fmt.Errorf("template path is required for S3 storage")
+	}
+	clean, err := CleanAssetPath(assetPath)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(template.TemplateS3Path), assetDir, clean), nil
+}
@@ -16,7 +16,7 @@ func (s *StreamStorage) GetTemplate(ctx context.Context, req *GetTemplateRequest
 		return nil, fmt.Errorf("input template stream is required for stream storage")
 	}
 
-	return template.New("stream").Parse(string(req.TemplateBytes))
+	return template.New("stream").Funcs(Funcs()).Parse(string(req.TemplateBytes))
 }
 func (s *StreamStorage) PutDocument(ctx context.Context, req *PostDocumentRequest, reader *io.Reader) (string, error) {
 	// Read all bytes from the rod.StreamReader
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"text/template"
 
 	"github.com/Zomato/espresso/lib/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 const (
@@ -32,6 +34,13 @@ type StorageAdapter interface {
 	CreateTemplate(ctx context.Context, req *CreateTemplateRequest) (string, error)
 }
 
+// IsNotExist reports whether err means the document or template asked for
+// does not exist, as opposed to the store failing to read it.
+func IsNotExist(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrAssetNotFound) || errors.As(err, &noSuchKey)
+}
+
 // TemplateStorageAdapterFactory is a factory function for creating template storage adapters.
 func TemplateStorageAdapterFactory(conf *StorageConfig) (StorageAdapter, error) {
 	switch conf.StorageType {
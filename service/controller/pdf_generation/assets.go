@@ -0,0 +1,120 @@
+package pdf_generation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+	"github.com/spf13/viper"
+)
+
+const defaultMaxAssetBytes = 10 << 20
+
+// PutTemplateAsset stores the request body as an asset of a template, e.g.
+//
+//	POST /template-assets?template_uuid=<uuid>&path=css/invoice.css
+//
+// Templates reference it as espresso-asset://<uuid>/css/invoice.css or by a
+// path relative to the template. Disk and S3 templates are identified with
+// template_path instead of template_uuid, relative to
+// template_storage.template_root; without a root only template_uuid is
+// accepted. The template must exist.
+func (s *EspressoService) PutTemplateAsset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+
+	assets, ok := (*s.TemplateStorageAdapter).(templatestore.AssetStore)
+	if !ok {
+		httppkg.RespondWithError(w, "Template storage does not support assets", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	req := &templatestore.PutAssetRequest{
+		Template:    templatestore.GetTemplateRequest{TemplateUUID: query.Get("template_uuid")},
+		ContentType: r.Header.Get("Content-Type"),
+	}
+	if templatePath := query.Get("template_path"); templatePath != "" {
+		resolved, err := resolveTemplatePath(viper.GetString("template_storage.template_root"), templatePath)
+		if err != nil {
+			httppkg.RespondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Template.TemplatePath = resolved
+		req.Template.TemplateS3Path = resolved
+	}
+	if req.Template.TemplateUUID == "" && req.Template.TemplatePath == "" {
+		httppkg.RespondWithError(w, "template_uuid or template_path is required", http.StatusBadRequest)
+		return
+	}
+
+	// assets are only kept for templates that exist, so a request cannot
+	// pick where they are written
+	if _, err := (*s.TemplateStorageAdapter).GetTemplate(ctx, &req.Template); err != nil {
+		if templatestore.IsNotExist(err) {
+			httppkg.RespondWithError(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		httppkg.RespondWithError(w, "Failed to get template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Path, err = templatestore.CleanAssetPath(query.Get("path")); err != nil {
+		httppkg.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxBytes := viper.GetInt64("template_storage.max_asset_bytes")
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxAssetBytes
+	}
+	req.Content, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httppkg.RespondWithError(w, "Asset is larger than the configured limit", http.StatusRequestEntityTooLarge)
+			return
+		}
+		httppkg.RespondWithError(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := assets.PutAsset(ctx, req); err != nil {
+		svcUtils.Logger.Error(ctx, "error storing template asset :: %v", err, nil)
+		httppkg.RespondWithError(w, "Failed to store asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Asset stored successfully",
+		},
+		"path": req.Path,
+	})
+}
+
+// resolveTemplatePath returns the path of a disk or S3 template below root.
+// Paths that leave root are rejected, and no path is accepted without one.
+func resolveTemplatePath(root, templatePath string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("template_path is not accepted without template_storage.template_root, use template_uuid")
+	}
+	clean, err := templatestore.CleanAssetPath(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("template_path %q is outside the template root", templatePath)
+	}
+	return path.Join(root, clean), nil
+}
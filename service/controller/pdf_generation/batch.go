@@ -0,0 +1,154 @@
+package pdf_generation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	"github.com/Zomato/espresso/service/internal/service/batch"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+// SubmitBatch accepts either an NDJSON body of records, with the batch
+// settings in the query string, or a JSON batch spec whose records_path
+// points at an NDJSON object in the file store.
+func (s *EspressoService) SubmitBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	var spec *batch.Spec
+	var records io.Reader
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-ndjson") {
+		var err error
+		spec, err = batchSpecFromQuery(r)
+		if err != nil {
+			httppkg.RespondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records = r.Body
+	} else {
+		spec = &batch.Spec{}
+		if err := json.NewDecoder(r.Body).Decode(spec); err != nil {
+			svcUtils.Logger.Error(ctx, "error decoding request body :: %v", err, nil)
+			httppkg.RespondWithError(w, "Error decoding request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if spec.InputTemplateUUID == "" && spec.InputFilePath == "" {
+		httppkg.RespondWithError(w, "input_template_uuid or input_file_path is required", http.StatusBadRequest)
+		return
+	}
+	spec.ClientID = clientID(r)
+	if spec.CertConfigKey == "" {
+		spec.CertConfigKey = "digital_certificates.cert1"
+	}
+
+	batchId, err := s.BatchRunner.Submit(ctx, spec, records)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "error submitting batch :: %v", err, nil)
+		httppkg.RespondWithError(w, "Failed to submit batch: "+err.Error(), batchErrorStatus(err))
+		return
+	}
+	svcUtils.Logger.Info(ctx, "batch submitted :: ", map[string]any{"batch_id": batchId})
+
+	responseData := map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Batch accepted",
+		},
+		"batch_id": batchId,
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(responseData)
+}
+
+func (s *EspressoService) GetBatchStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	progress, err := s.BatchRunner.Status(ctx, r.URL.Query().Get("batch_id"))
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "error getting batch status :: %v", err, nil)
+		httppkg.RespondWithError(w, "Failed to get batch status: "+err.Error(), batchErrorStatus(err))
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Batch retrieved successfully",
+		},
+		"batch": progress,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responseData)
+}
+
+func (s *EspressoService) GetBatchManifest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	batchId := r.URL.Query().Get("batch_id")
+
+	if _, err := s.BatchRunner.Status(ctx, batchId); err != nil {
+		httppkg.RespondWithError(w, "Failed to get batch manifest: "+err.Error(), batchErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if err := s.BatchRunner.Manifest(ctx, batchId, w); err != nil {
+		svcUtils.Logger.Error(ctx, "error writing batch manifest :: %v", err, nil)
+	}
+}
+
+func batchSpecFromQuery(r *http.Request) (*batch.Spec, error) {
+	query := r.URL.Query()
+	spec := &batch.Spec{
+		BatchID:           query.Get("batch_id"),
+		InputTemplateUUID: query.Get("template_uuid"),
+		InputFilePath:     query.Get("input_file_path"),
+		ManifestPath:      query.Get("manifest_path"),
+		CertConfigKey:     query.Get("cert_config_key"),
+	}
+
+	pdfParams := &generateDoc.PDFParams{PrintBackground: true}
+	pdfParams.Landscape = query.Get("landscape") == "true"
+	pdfParams.IsSinglePage = query.Get("single_page") == "true"
+
+	margin := 0.4 // Default margin of 0.4 inches
+	if m := query.Get("margin_inch"); m != "" {
+		var err error
+		if margin, err = strconv.ParseFloat(m, 64); err != nil {
+			return nil, errors.New("margin_inch must be a number")
+		}
+	}
+	pdfParams.MarginTop = margin
+	pdfParams.MarginBottom = margin
+	pdfParams.MarginLeft = margin
+	pdfParams.MarginRight = margin
+	spec.PdfParams = pdfParams
+
+	return spec, nil
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, batch.ErrBatchNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, batch.ErrBatchRunning), errors.Is(err, batch.ErrBatchDone), errors.Is(err, batch.ErrInputChanged):
+		return http.StatusConflict
+	case errors.Is(err, batch.ErrInvalidBatchID), errors.Is(err, batch.ErrNoRecords):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,78 @@
+package pdf_generation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Zomato/espresso/lib/renderer"
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+	"github.com/spf13/viper"
+)
+
+const defaultMaxFontBytes = 20 << 20
+
+// Fonts lists the registered fonts on GET, and registers the TTF, OTF or
+// WOFF2 font in the request body on POST, e.g.
+//
+//	POST /fonts?family=Noto Sans Devanagari&weight=700&style=normal
+func (s *EspressoService) Fonts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	registry := generateDoc.Fonts()
+
+	switch r.Method {
+	case http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"fonts": registry.List()})
+		return
+	case http.MethodPost, http.MethodPut:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxBytes := viper.GetInt64("fonts.max_bytes")
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxFontBytes
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httppkg.RespondWithError(w, "Font is larger than the configured limit", http.StatusRequestEntityTooLarge)
+			return
+		}
+		httppkg.RespondWithError(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	font, err := registry.Add(ctx, &renderer.AddFontRequest{
+		Family:  query.Get("family"),
+		Weight:  query.Get("weight"),
+		Style:   query.Get("style"),
+		Content: content,
+	})
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "error registering font :: %v", err, nil)
+		status := http.StatusInternalServerError
+		if errors.Is(err, renderer.ErrInvalidFont) {
+			status = http.StatusBadRequest
+		}
+		httppkg.RespondWithError(w, "Failed to register font: "+err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Font registered successfully",
+		},
+		"font": font,
+	})
+}
@@ -0,0 +1,117 @@
+package pdf_generation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	"github.com/Zomato/espresso/service/internal/service/jobs"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+func (s *EspressoService) CreateJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	req := &CreateJobRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		svcUtils.Logger.Error(ctx, "error decoding request body :: %v", err, nil)
+		httppkg.RespondWithError(w, "Error decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.OutputFilePath == "" {
+		httppkg.RespondWithError(w, "output_file_path is required for jobs", http.StatusBadRequest)
+		return
+	}
+	if req.WebhookURL != "" {
+		if u, err := url.Parse(req.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			httppkg.RespondWithError(w, "webhook_url must be an absolute http(s) URL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pdfParams := req.PdfParams
+	if pdfParams == nil {
+		pdfParams = &generateDoc.PDFParams{}
+	}
+
+	generatePdfReq := &generateDoc.PDFDto{
+		InputTemplatePath:  req.InputFilePath,
+		InputFileBytes:     req.InputFileBytes,
+		InputTemplateUUID:  req.InputTemplateUuid,
+		OutputTemplatePath: req.OutputFilePath,
+		Content:            req.Content,
+		ViewPort:           req.Viewport,
+		PdfParams:          pdfParams,
+		BypassCache:        req.BypassCache,
+		ClientID:           clientID(r),
+	}
+	if req.SignParams != nil && req.SignParams.SignPdf {
+		generatePdfReq.SignParams = req.SignParams
+	}
+
+	jobId, err := s.JobRunner.Submit(ctx, generatePdfReq, req.WebhookURL)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "error submitting job :: %v", err, nil)
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrQueueFull) {
+			statusCode = http.StatusServiceUnavailable
+		} else if errors.Is(err, jobs.ErrWebhookNotAllowed) {
+			statusCode = http.StatusBadRequest
+		}
+		httppkg.RespondWithError(w, "Failed to submit job: "+err.Error(), statusCode)
+		return
+	}
+	svcUtils.Logger.Info(ctx, "job submitted :: ", map[string]any{"job_id": jobId})
+
+	responseData := map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Job queued successfully",
+		},
+		"job_id":     jobId,
+		"job_status": jobs.StatusQueued,
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(responseData)
+}
+
+func (s *EspressoService) GetJobStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobId := r.URL.Query().Get("job_id")
+	if jobId == "" {
+		httppkg.RespondWithError(w, "job id is required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.JobRunner.Status(ctx, jobId)
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			httppkg.RespondWithError(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		svcUtils.Logger.Error(ctx, "error getting job status :: %v", err, nil)
+		httppkg.RespondWithError(w, "Failed to get job status: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Job retrieved successfully",
+		},
+		"job": status,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responseData)
+}
@@ -0,0 +1,89 @@
+package pdf_generation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/Zomato/espresso/lib/renderer"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+const maxLintTemplateBytes = 5 << 20
+
+// LintTemplate reports what would change if a template switched to html
+// escaping. GET lints a stored template, by template_id or template_path;
+// POST lints the template in the request body.
+func (s *EspressoService) LintTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+
+	var tmpl *template.Template
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if query.Get("template_id") == "" && query.Get("template_path") == "" {
+			httppkg.RespondWithError(w, "template_id or template_path is required", http.StatusBadRequest)
+			return
+		}
+		tmpl, err = (*s.TemplateStorageAdapter).GetTemplate(ctx, &templatestore.GetTemplateRequest{
+			TemplateUUID: query.Get("template_id"),
+			TemplatePath: query.Get("template_path"),
+		})
+		if err != nil {
+			svcUtils.Logger.Error(ctx, "error getting template :: %v", err, nil)
+			httppkg.RespondWithError(w, "Failed to get template: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLintTemplateBytes))
+		if err != nil {
+			httppkg.RespondWithError(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl, err = template.New("template").Funcs(templatestore.Funcs()).Parse(string(content))
+		if err != nil {
+			httppkg.RespondWithError(w, "Failed to parse template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	escaping, err := renderer.TemplateEscaping(tmpl)
+	if err != nil {
+		httppkg.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	issues, err := renderer.LintEscaping(tmpl)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "error linting template :: %v", err, nil)
+		httppkg.RespondWithError(w, "Failed to lint template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type issue struct {
+		Location string `json:"location"`
+		Action   string `json:"action,omitempty"`
+		Message  string `json:"message"`
+	}
+	found := make([]issue, 0, len(issues))
+	for _, i := range issues {
+		found = append(found, issue{Location: i.Location, Action: i.Action, Message: i.Message})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": map[string]string{
+			"status":  "success",
+			"message": "Template linted successfully",
+		},
+		"escaping": escaping,
+		"issues":   found,
+	})
+}
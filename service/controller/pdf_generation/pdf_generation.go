@@ -2,13 +2,17 @@ package pdf_generation
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/renderer"
 	"github.com/Zomato/espresso/lib/templatestore"
 	"github.com/Zomato/espresso/lib/utils"
 	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
@@ -50,6 +54,8 @@ func (s *EspressoService) GeneratePDF(w http.ResponseWriter, r *http.Request) {
 		Content:            req.Content,
 		ViewPort:           req.Viewport,
 		PdfParams:          req.PdfParams,
+		BypassCache:        req.BypassCache,
+		ClientID:           clientID(r),
 	}
 
 	if req.SignParams != nil && req.SignParams.SignPdf {
@@ -59,7 +65,7 @@ func (s *EspressoService) GeneratePDF(w http.ResponseWriter, r *http.Request) {
 	err = generateDoc.GeneratePDF(ctx, generatePdfReq, s.TemplateStorageAdapter, s.FileStorageAdapter)
 	if err != nil {
 		svcUtils.Logger.Error(ctx, "error in generating pdf :: %v", err, nil)
-		httppkg.RespondWithError(w, "Failed to generate PDF: "+err.Error(), http.StatusInternalServerError)
+		httppkg.RespondWithError(w, "Failed to generate PDF: "+err.Error(), renderErrorStatus(w, err))
 		return
 	}
 
@@ -71,6 +77,12 @@ func (s *EspressoService) GeneratePDF(w http.ResponseWriter, r *http.Request) {
 		"output_file_path":  req.OutputFilePath,
 		"output_file_bytes": generatePdfReq.OutputFileBytes,
 	}
+	if len(generatePdfReq.FontsUsed) > 0 {
+		responseData["fonts_used"] = generatePdfReq.FontsUsed
+	}
+	if len(generatePdfReq.Images) > 0 {
+		responseData["images"] = generatePdfReq.Images
+	}
 
 	duration := time.Since(startTime)
 	svcUtils.Logger.Info(ctx, "generated pdf :: ", map[string]any{"req_id": reqId, "duration": duration})
@@ -138,7 +150,9 @@ func (s *EspressoService) GeneratePDFStream(w http.ResponseWriter, r *http.Reque
 		Content:           pdfReq.Content,
 		SignParams:        &generateDoc.SignParams{SignPdf: pdfReq.SignPdf},
 		// ViewPort:          req.Viewport,
-		PdfParams: pdfSettings,
+		PdfParams:   pdfSettings,
+		BypassCache: pdfReq.BypassCache,
+		ClientID:    clientID(r),
 	}
 	if pdfReq.SignPdf {
 		generatePdfReq.SignParams = &generateDoc.SignParams{
@@ -167,7 +181,7 @@ func (s *EspressoService) GeneratePDFStream(w http.ResponseWriter, r *http.Reque
 	err = generateDoc.GeneratePDF(ctx, generatePdfReq, &templateStorageAdapter, &fileStorageAdapter)
 	if err != nil {
 		svcUtils.Logger.Error(ctx, "error in generating pdf stream:: %v", err, nil)
-		httppkg.RespondWithError(w, "Failed to generate PDF stream: "+err.Error(), http.StatusInternalServerError)
+		httppkg.RespondWithError(w, "Failed to generate PDF stream: "+err.Error(), renderErrorStatus(w, err))
 		return
 	}
 	// Determine filename for the PDF
@@ -190,6 +204,12 @@ func (s *EspressoService) GeneratePDFStream(w http.ResponseWriter, r *http.Reque
 		// Always return the PDF file directly for download
 		w.Header().Set("Content-Type", "application/pdf")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+		if len(generatePdfReq.FontsUsed) > 0 {
+			w.Header().Set("X-Espresso-Fonts-Used", strings.Join(generatePdfReq.FontsUsed, ", "))
+		}
+		if len(generatePdfReq.Images) > 0 {
+			w.Header().Set("X-Espresso-Images", generateDoc.ImageSummary(generatePdfReq.Images))
+		}
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(generatePdfReq.OutputFileBytes)))
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
@@ -411,3 +431,29 @@ func (s *EspressoService) CreateTemplate(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(responseData)
 
 }
+
+// clientID identifies the API client from the header set by the gateway in
+// front of the service.
+func clientID(r *http.Request) string {
+	return r.Header.Get(viper.GetString("allowlists.client_header"))
+}
+
+// renderErrorStatus maps a render failure to a status code. When the browser
+// is overloaded it also sets Retry-After so load balancers can back off.
+func renderErrorStatus(w http.ResponseWriter, err error) int {
+	var overloaded *browser_manager.OverloadedError
+	if errors.As(err, &overloaded) {
+		w.Header().Set("Retry-After", strconv.Itoa(viper.GetInt("browser.retry_after")))
+		return http.StatusServiceUnavailable
+	}
+	var timedOut *renderer.RenderTimeoutError
+	if errors.As(err, &timedOut) {
+		return http.StatusGatewayTimeout
+	}
+	// an image of the content failed a strict image policy
+	var image *renderer.ImageError
+	if errors.As(err, &image) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
@@ -1,49 +1,68 @@
 package pdf_generation
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/renderer"
 	"github.com/Zomato/espresso/lib/s3"
 	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/service/batch"
+	"github.com/Zomato/espresso/service/internal/service/consumer"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	"github.com/Zomato/espresso/service/internal/service/idempotency"
+	"github.com/Zomato/espresso/service/internal/service/jobs"
+	"github.com/Zomato/espresso/service/internal/service/pdfcache"
 	"github.com/spf13/viper"
 )
 
 type EspressoService struct {
 	TemplateStorageAdapter *templatestore.StorageAdapter
 	FileStorageAdapter     *templatestore.StorageAdapter
+	Idempotency            *idempotency.Middleware
+	JobRunner              *jobs.Runner
+	BatchRunner            *batch.Runner
+	Browser                *browser_manager.Manager
 }
 
-func NewEspressoService() (*EspressoService, error) {
+func NewEspressoService(browser *browser_manager.Manager) (*EspressoService, error) {
+	generateDoc.SetBrowser(browser)
+
 	templateStorageType := viper.GetString("template_storage.storage_type")
 	if os.Getenv("ENABLE_UI") == "true" && templateStorageType != templatestore.StorageAdapterTypeMySQL {
 		return nil, fmt.Errorf("UI requires MySQL as template storage adapter, got: %s", templateStorageType)
 	}
+	s3Config := &s3.Config{
+		Endpoint:              viper.GetString("s3.endpoint"),
+		Region:                viper.GetString("s3.region"),
+		Bucket:                viper.GetString("s3.bucket"),
+		Debug:                 viper.GetBool("s3.debug"),
+		ForcePathStyle:        viper.GetBool("s3.forcePathStyle"),
+		UploaderConcurrency:   viper.GetInt("s3.uploaderConcurrency"),
+		UploaderPartSize:      viper.GetInt64("s3.uploaderPartSize"),
+		DownloaderConcurrency: viper.GetInt("s3.downloaderConcurrency"),
+		DownloaderPartSize:    viper.GetInt64("s3.downloaderPartSize"),
+		RetryMaxAttempts:      viper.GetInt("s3.retryMaxAttempts"),
+		UseCustomTransport:    viper.GetBool("s3.useCustomTransport"),
+	}
+	awsCredConfig := &s3.AwsCredConfig{
+		AccessKeyID:     viper.GetString("aws.accessKeyID"),
+		SecretAccessKey: viper.GetString("aws.secretAccessKey"),
+		SessionToken:    viper.GetString("aws.sessionToken"),
+	}
 	templateStorageAdapter, err := templatestore.TemplateStorageAdapterFactory(&templatestore.StorageConfig{
 		StorageType: templateStorageType,
 		// for s3 storage only
-		S3Config: &s3.Config{
-			Endpoint:              viper.GetString("s3.endpoint"),
-			Region:                viper.GetString("s3.region"),
-			Bucket:                viper.GetString("s3.bucket"),
-			Debug:                 viper.GetBool("s3.debug"),
-			ForcePathStyle:        viper.GetBool("s3.forcePathStyle"),
-			UploaderConcurrency:   viper.GetInt("s3.uploaderConcurrency"),
-			UploaderPartSize:      viper.GetInt64("s3.uploaderPartSize"),
-			DownloaderConcurrency: viper.GetInt("s3.downloaderConcurrency"),
-			DownloaderPartSize:    viper.GetInt64("s3.downloaderPartSize"),
-			RetryMaxAttempts:      viper.GetInt("s3.retryMaxAttempts"),
-			UseCustomTransport:    viper.GetBool("s3.useCustomTransport"),
-		},
+		S3Config: s3Config,
 		// for s3 storage only
-		AwsCredConfig: &s3.AwsCredConfig{
-			AccessKeyID:     viper.GetString("aws.accessKeyID"),
-			SecretAccessKey: viper.GetString("aws.secretAccessKey"),
-			SessionToken:    viper.GetString("aws.sessionToken"),
-		},
-		MysqlDSN: viper.GetString("mysql.dsn"), // for mysql adapter
+		AwsCredConfig: awsCredConfig,
+		MysqlDSN:      viper.GetString("mysql.dsn"), // for mysql adapter
 	})
 	if err != nil {
 		return nil, err
@@ -56,10 +75,142 @@ func NewEspressoService() (*EspressoService, error) {
 		return nil, err
 	}
 
-	return &EspressoService{TemplateStorageAdapter: &templateStorageAdapter, FileStorageAdapter: &fileStorageAdapter}, nil
+	espressoService := &EspressoService{TemplateStorageAdapter: &templateStorageAdapter, FileStorageAdapter: &fileStorageAdapter, Browser: browser}
+
+	if viper.GetBool("cache.enabled") {
+		cache, err := newRenderCache(&fileStorageAdapter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize render cache: %v", err)
+		}
+		generateDoc.SetCache(cache)
+	}
+
+	if viper.GetBool("fonts.enabled") {
+		registry, err := renderer.NewFontRegistry(context.Background(), fileStorageAdapter, viper.GetString("fonts.prefix"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize font registry: %v", err)
+		}
+		generateDoc.SetFonts(registry)
+	}
+
+	if prefixes := viper.GetStringSlice("prefetch_images.storage_prefixes"); len(prefixes) > 0 {
+		stores, err := newImageStores(fileStorageAdapter, s3Config, awsCredConfig, prefixes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize image stores: %v", err)
+		}
+		generateDoc.SetImageStores(stores)
+	}
+
+	if viper.GetBool("idempotency.enabled") {
+		var store idempotency.Store
+		switch viper.GetString("idempotency.store") {
+		case "mysql":
+			store, err = idempotency.NewMySQLStore(viper.GetString("mysql.dsn"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize idempotency store: %v", err)
+			}
+		case "memory":
+			store = idempotency.NewMemoryStore()
+		default:
+			return nil, fmt.Errorf("unsupported idempotency store: %s", viper.GetString("idempotency.store"))
+		}
+		espressoService.Idempotency = idempotency.NewMiddleware(store, idempotency.Config{
+			Retention:    time.Duration(viper.GetInt("idempotency.retention")) * time.Second,
+			InFlightTTL:  time.Duration(viper.GetInt("idempotency.in_flight_ttl")) * time.Second,
+			Wait:         time.Duration(viper.GetInt("idempotency.in_flight_wait")) * time.Millisecond,
+			ClientHeader: viper.GetString("allowlists.client_header"),
+		})
+	}
+
+	if viper.GetBool("jobs.enabled") {
+		// with a secret anyone can guess, anyone can sign a webhook
+		if secret := viper.GetString("jobs.webhook_secret"); secret == "" || secret == "change-me" {
+			return nil, fmt.Errorf("jobs.webhook_secret must be set to a secret of your own when jobs are enabled")
+		}
+		webhookAllowlist, err := browser_manager.CompileAllowlist(viper.GetStringSlice("jobs.webhook_allowed_domains"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid jobs.webhook_allowed_domains: %v", err)
+		}
+		jobStore, err := jobs.NewMySQLStore(viper.GetString("mysql.dsn"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize job store: %v", err)
+		}
+		espressoService.JobRunner = jobs.NewRunner(jobs.Config{
+			Workers:          viper.GetInt("jobs.workers"),
+			QueueSize:        viper.GetInt("jobs.queue_size"),
+			WebhookSecret:    viper.GetString("jobs.webhook_secret"),
+			WebhookTimeout:   time.Duration(viper.GetInt("jobs.webhook_timeout")) * time.Millisecond,
+			WebhookAllowlist: webhookAllowlist,
+			PresignExpiry:    time.Duration(viper.GetInt("jobs.presign_expiry")) * time.Second,
+		}, jobStore, &templateStorageAdapter, &fileStorageAdapter)
+	}
+
+	if viper.GetBool("batch.enabled") {
+		// never render more records at once than there are tabs to render them in
+		concurrency := viper.GetInt("batch.concurrency")
+		if tabPool := browser.TotalTabs(); tabPool > 0 && concurrency > tabPool {
+			concurrency = tabPool
+		}
+		espressoService.BatchRunner, err = batch.NewRunner(batch.Config{
+			Concurrency:   concurrency,
+			CheckpointDir: viper.GetString("batch.checkpoint_dir"),
+		}, &templateStorageAdapter, &fileStorageAdapter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize batch runner: %v", err)
+		}
+	}
+
+	return espressoService, nil
 }
-func Register(mux *http.ServeMux) {
-	espressoService, err := NewEspressoService()
+func newRenderCache(fileStorageAdapter *templatestore.StorageAdapter) (*pdfcache.Cache, error) {
+	var backend pdfcache.Backend
+	var err error
+
+	switch viper.GetString("cache.backend") {
+	case pdfcache.BackendMemory:
+		backend = pdfcache.NewMemoryBackend(viper.GetInt("cache.max_entries"), viper.GetInt64("cache.max_bytes"))
+	case pdfcache.BackendDisk:
+		backend, err = pdfcache.NewDiskBackend(viper.GetString("cache.dir"))
+	case pdfcache.BackendStore:
+		backend, err = pdfcache.NewStoreBackend(fileStorageAdapter, viper.GetString("cache.prefix"))
+	default:
+		err = fmt.Errorf("unsupported cache backend: %s", viper.GetString("cache.backend"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pdfcache.New(backend, time.Duration(viper.GetInt("cache.ttl"))*time.Second), nil
+}
+
+// newImageStores lets renders inline store:// images from the file storage
+// and s3:// images from the configured bucket, below prefixes only.
+func newImageStores(fileStorageAdapter templatestore.StorageAdapter, s3Config *s3.Config, awsCredConfig *s3.AwsCredConfig, prefixes []string) (*renderer.ImageStores, error) {
+	stores := &renderer.ImageStores{Store: fileStorageAdapter, Prefixes: prefixes}
+	if s3Config.Bucket == "" {
+		return stores, nil
+	}
+
+	client, err := s3.NewS3Client(context.Background(), s3.WithEndpoint(s3Config.Endpoint),
+		s3.WithDebug(s3Config.Debug),
+		s3.WithRegion(s3Config.Region),
+		s3.WithForcePathStyle(s3Config.ForcePathStyle),
+		s3.WithDownloaderConcurrency(s3Config.DownloaderConcurrency),
+		s3.WithDownloaderPartSize(s3Config.DownloaderPartSize),
+		s3.WithRetryMaxAttempts(s3Config.RetryMaxAttempts),
+		s3.WithBucket(s3Config.Bucket),
+		s3.WithCustomTransport(s3Config.UseCustomTransport),
+		s3.WithCredentials(awsCredConfig.AccessKeyID,
+			awsCredConfig.SecretAccessKey, awsCredConfig.SessionToken))
+	if err != nil {
+		return nil, err
+	}
+	stores.S3 = map[string]*s3.S3Client{s3Config.Bucket: client}
+	return stores, nil
+}
+
+func Register(mux *http.ServeMux, browser *browser_manager.Manager) {
+	espressoService, err := NewEspressoService(browser)
 	if err != nil {
 		log.Fatalf("Failed to initialize PDF service: %v", err)
 	}
@@ -70,11 +221,88 @@ func Register(mux *http.ServeMux) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.HandleFunc("/browser/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(browser.Stats())
+	})
 
-	mux.HandleFunc("/generate-pdf-stream", espressoService.GeneratePDFStream)
+	mux.HandleFunc("/generate-pdf-stream", espressoService.idempotent(espressoService.GeneratePDFStream))
 	mux.HandleFunc("/create-template", espressoService.CreateTemplate)
 	mux.HandleFunc("/list-templates", espressoService.GetAllTemplates)
 	mux.HandleFunc("/get-template", espressoService.GetTemplateById)
-	mux.HandleFunc("/generate-pdf", espressoService.GeneratePDF)
+	mux.HandleFunc("/template-lint", espressoService.LintTemplate)
+	mux.HandleFunc("/generate-pdf", espressoService.idempotent(espressoService.GeneratePDF))
+
+	if _, ok := (*espressoService.TemplateStorageAdapter).(templatestore.AssetStore); ok {
+		mux.HandleFunc("/template-assets", espressoService.PutTemplateAsset)
+	}
+
+	if generateDoc.Fonts() != nil {
+		mux.HandleFunc("/fonts", espressoService.Fonts)
+	}
+
+	if espressoService.JobRunner != nil {
+		if err := espressoService.JobRunner.Start(context.Background()); err != nil {
+			log.Fatalf("Failed to start job runner: %v", err)
+		}
+		mux.HandleFunc("/jobs", espressoService.CreateJob)
+		mux.HandleFunc("/jobs/status", espressoService.GetJobStatus)
+	}
+
+	if espressoService.BatchRunner != nil {
+		if err := espressoService.BatchRunner.Start(context.Background()); err != nil {
+			log.Fatalf("Failed to start batch runner: %v", err)
+		}
+		mux.HandleFunc("/batch", espressoService.SubmitBatch)
+		mux.HandleFunc("/batch/status", espressoService.GetBatchStatus)
+		mux.HandleFunc("/batch/manifest", espressoService.GetBatchManifest)
+	}
+
+	if viper.GetBool("consumer.enabled") {
+		startConsumer(espressoService)
+	}
+
+}
+
+// idempotent honours Idempotency-Key headers on handler when enabled.
+func (s *EspressoService) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	if s.Idempotency == nil {
+		return handler
+	}
+	return s.Idempotency.Wrap(handler)
+}
+
+// startConsumer runs the queue consumer in the background, sharing the storage
+// adapters used by the HTTP handlers.
+func startConsumer(espressoService *EspressoService) {
+	queue, err := consumer.NewQueue(
+		viper.GetString("consumer.driver"),
+		viper.GetString("consumer.url"),
+		viper.GetString("consumer.queue_group"),
+	)
+	if err != nil {
+		log.Fatalf("Failed to initialize consumer queue: %v", err)
+	}
+
+	// default to, and never exceed, one message per browser tab
+	tabPool := espressoService.Browser.TotalTabs()
+	concurrency := viper.GetInt("consumer.concurrency")
+	if concurrency <= 0 || (tabPool > 0 && concurrency > tabPool) {
+		concurrency = tabPool
+	}
+
+	c := consumer.NewConsumer(consumer.Config{
+		InputTopic:      viper.GetString("consumer.input_topic"),
+		ResultTopic:     viper.GetString("consumer.result_topic"),
+		DeadLetterTopic: viper.GetString("consumer.dead_letter_topic"),
+		Concurrency:     concurrency,
+		MaxAttempts:     viper.GetInt("consumer.max_attempts"),
+		Backoff:         time.Duration(viper.GetInt("consumer.backoff")) * time.Millisecond,
+	}, queue, espressoService.TemplateStorageAdapter, espressoService.FileStorageAdapter)
 
+	go func() {
+		if err := c.Run(context.Background()); err != nil {
+			log.Fatalf("Queue consumer stopped: %v", err)
+		}
+	}()
 }
@@ -15,6 +15,7 @@ type GeneratePDFRequest struct {
 	Viewport          *generateDoc.ViewportConfig `json:"viewport"`
 	PdfParams         *generateDoc.PDFParams      `json:"pdf_params,omitempty"`
 	SignParams        *generateDoc.SignParams     `json:"sign_params,omitempty"`
+	BypassCache       bool                        `json:"bypass_cache,omitempty"`
 }
 
 type GeneratePDFResponse struct {
@@ -30,6 +31,7 @@ type PDFRequest struct {
 	MarginInch   float64         `json:"margin_inch,omitempty"`
 	Filename     string          `json:"filename,omitempty"` // Optional filename for download
 	SignPdf      bool            `json:"sign_pdf,omitempty"`
+	BypassCache  bool            `json:"bypass_cache,omitempty"`
 }
 
 // PDFResponse represents the structure for successful responses
@@ -82,3 +84,8 @@ type CreateTemplateResponse struct {
 	TemplateId string `json:"template_id"`
 	Error      string `json:"error,omitempty"`
 }
+
+type CreateJobRequest struct {
+	GeneratePDFRequest
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
@@ -0,0 +1,153 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A batch is checkpointed on local disk as:
+//
+//	<dir>/<batch_id>.spec.json   the Spec
+//	<dir>/<batch_id>.input       the spooled NDJSON records (streamed batches only)
+//	<dir>/<batch_id>.manifest    one Result per line, appended as records finish
+//	<dir>/<batch_id>.done        written once every record has a result
+//
+// Resuming re-reads the manifest and skips records that already succeeded.
+type checkpoint struct {
+	dir     string
+	batchID string
+}
+
+func (c checkpoint) path(ext string) string {
+	return filepath.Join(c.dir, c.batchID+ext)
+}
+
+func (c checkpoint) specPath() string     { return c.path(".spec.json") }
+func (c checkpoint) inputPath() string    { return c.path(".input") }
+func (c checkpoint) manifestPath() string { return c.path(".manifest") }
+func (c checkpoint) donePath() string     { return c.path(".done") }
+
+func (c checkpoint) writeSpec(spec *Spec) error {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch spec: %v", err)
+	}
+	return os.WriteFile(c.specPath(), b, 0600)
+}
+
+func (c checkpoint) readSpec() (*Spec, error) {
+	b, err := os.ReadFile(c.specPath())
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal batch spec: %v", err)
+	}
+	return spec, nil
+}
+
+func (c checkpoint) spoolInput(r io.Reader) error {
+	f, err := os.OpenFile(c.inputPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create batch input file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to spool batch input: %v", err)
+	}
+	return f.Sync()
+}
+
+func (c checkpoint) isDone() bool {
+	_, err := os.Stat(c.donePath())
+	return err == nil
+}
+
+func (c checkpoint) markDone() error {
+	return os.WriteFile(c.donePath(), nil, 0600)
+}
+
+// readResults returns the latest result recorded for every record index. A
+// record retried on resume appears twice in the manifest; the later line wins.
+func (c checkpoint) readResults() (map[int]Result, error) {
+	results := map[int]Result{}
+
+	f, err := os.Open(c.manifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var res Result
+		// a crash can leave a torn last line behind, it is simply redone
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			continue
+		}
+		results[res.Index] = res
+	}
+	return results, scanner.Err()
+}
+
+// manifestWriter appends results to the checkpoint manifest. Each line is
+// flushed to the OS as it is written so a crash loses at most the records
+// that were in flight.
+type manifestWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (c checkpoint) openManifest() (*manifestWriter, error) {
+	f, err := os.OpenFile(c.manifestPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch manifest: %v", err)
+	}
+	return &manifestWriter{f: f}, nil
+}
+
+func (m *manifestWriter) write(res Result) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = m.f.Write(append(b, '\n'))
+	return err
+}
+
+func (m *manifestWriter) Close() error {
+	if err := m.f.Sync(); err != nil {
+		m.f.Close()
+		return err
+	}
+	return m.f.Close()
+}
+
+// listBatchIDs returns the IDs of every batch with a spec in dir.
+func listBatchIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".spec.json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,58 @@
+package batch
+
+import (
+	"encoding/json"
+
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+)
+
+// Spec describes everything about a batch except its records. It is
+// persisted next to the checkpoint so a batch can be resumed after a crash.
+type Spec struct {
+	BatchID           string                      `json:"batch_id"`
+	InputTemplateUUID string                      `json:"input_template_uuid,omitempty"`
+	InputFilePath     string                      `json:"input_file_path,omitempty"`
+	Viewport          *generateDoc.ViewportConfig `json:"viewport,omitempty"`
+	PdfParams         *generateDoc.PDFParams      `json:"pdf_params,omitempty"`
+	// ClientID is the API client that submitted the batch, see
+	// generateDoc.PDFDto.ClientID.
+	ClientID string `json:"client_id,omitempty"`
+	// CertConfigKey is used for records that ask to be signed.
+	CertConfigKey string `json:"cert_config_key,omitempty"`
+	// RecordsPath is the file store path of an NDJSON object of records.
+	// Empty when the records were streamed in the request body.
+	RecordsPath string `json:"records_path,omitempty"`
+	// ManifestPath is where the final manifest is stored in the file store.
+	ManifestPath string `json:"manifest_path,omitempty"`
+}
+
+// Record is one line of the NDJSON input.
+type Record struct {
+	ID             string          `json:"id,omitempty"`
+	Content        json.RawMessage `json:"content"`
+	OutputFilePath string          `json:"output_file_path"`
+	SignPdf        bool            `json:"sign_pdf,omitempty"`
+}
+
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// Result is one line of the manifest.
+type Result struct {
+	Index          int    `json:"index"`
+	ID             string `json:"id,omitempty"`
+	OutputFilePath string `json:"output_file_path,omitempty"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+	DurationMs     int64  `json:"duration_ms"`
+}
+
+type Progress struct {
+	BatchID      string `json:"batch_id"`
+	Done         bool   `json:"done"`
+	Succeeded    int    `json:"succeeded"`
+	Failed       int    `json:"failed"`
+	ManifestPath string `json:"manifest_path,omitempty"`
+}
@@ -0,0 +1,470 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/lib/utils"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+var (
+	ErrBatchNotFound  = errors.New("batch not found")
+	ErrBatchRunning   = errors.New("batch is already running")
+	ErrBatchDone      = errors.New("batch has already completed")
+	ErrInvalidBatchID = errors.New("batch id may only contain letters, digits, '-' and '_'")
+	ErrNoRecords      = errors.New("either a records body or records_path is required")
+	ErrInputChanged   = errors.New("batch already exists with other records, resume it without a body and with the same records_path")
+)
+
+var batchIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// maxRecordSize bounds a single NDJSON line, content included.
+const maxRecordSize = 16 * 1024 * 1024
+
+type Config struct {
+	// Concurrency is the number of records rendered at once across all
+	// running batches. It should not exceed the browser tab pool.
+	Concurrency   int
+	CheckpointDir string
+}
+
+// Runner renders batches of records against a single template in the
+// background, checkpointing progress so that a batch can resume after a crash.
+type Runner struct {
+	dir           string
+	sem           chan struct{}
+	templateStore *templatestore.StorageAdapter
+	fileStore     *templatestore.StorageAdapter
+
+	// maxRecordSize bounds a single NDJSON line; longer ones fail as records.
+	maxRecordSize int
+	generate      func(ctx context.Context, req *generateDoc.PDFDto) error
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewRunner(conf Config, templateStore, fileStore *templatestore.StorageAdapter) (*Runner, error) {
+	if _, ok := (*fileStore).(*templatestore.StreamStorage); ok {
+		return nil, errors.New("batch generation needs a disk or s3 file storage, not stream")
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	if err := os.MkdirAll(conf.CheckpointDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create batch checkpoint directory: %v", err)
+	}
+
+	return &Runner{
+		dir:           conf.CheckpointDir,
+		sem:           make(chan struct{}, conf.Concurrency),
+		templateStore: templateStore,
+		fileStore:     fileStore,
+		maxRecordSize: maxRecordSize,
+		generate: func(ctx context.Context, req *generateDoc.PDFDto) error {
+			return generateDoc.GeneratePDF(ctx, req, templateStore, fileStore)
+		},
+		running: map[string]bool{},
+	}, nil
+}
+
+// Start resumes every batch that had not completed when the service stopped.
+func (r *Runner) Start(ctx context.Context) error {
+	ids, err := listBatchIDs(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list batches: %v", err)
+	}
+
+	resumed := 0
+	for _, id := range ids {
+		cp := r.checkpoint(id)
+		if cp.isDone() {
+			continue
+		}
+		spec, err := cp.readSpec()
+		if err != nil {
+			svcUtils.Logger.Error(ctx, "failed to read batch spec, not resuming", err, map[string]any{"batch_id": id})
+			continue
+		}
+		if r.markRunning(id) {
+			go r.process(ctx, cp, spec)
+			resumed++
+		}
+	}
+	svcUtils.Logger.Info(ctx, "batch runner started", map[string]any{"concurrency": cap(r.sem), "resumed": resumed})
+
+	return nil
+}
+
+// Submit checkpoints spec and starts rendering it in the background. records
+// is the NDJSON record stream; it may be nil when spec.RecordsPath is set or
+// when resuming a batch whose input was already spooled.
+func (r *Runner) Submit(ctx context.Context, spec *Spec, records io.Reader) (string, error) {
+	if spec.BatchID == "" {
+		spec.BatchID = utils.GenerateUniqueID(ctx)
+	}
+	if !batchIDRegex.MatchString(spec.BatchID) {
+		return "", ErrInvalidBatchID
+	}
+
+	cp := r.checkpoint(spec.BatchID)
+	if cp.isDone() {
+		return "", ErrBatchDone
+	}
+	if !r.markRunning(spec.BatchID) {
+		return "", ErrBatchRunning
+	}
+
+	if err := r.prepare(cp, spec, records); err != nil {
+		r.markStopped(spec.BatchID)
+		return "", err
+	}
+
+	go r.process(context.Background(), cp, spec)
+	return spec.BatchID, nil
+}
+
+func (r *Runner) prepare(cp checkpoint, spec *Spec, records io.Reader) error {
+	// the manifest is keyed by record index, so it only holds for the input
+	// it was written for
+	existing, err := cp.readSpec()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if existing != nil && (records != nil || spec.RecordsPath != existing.RecordsPath) {
+		return ErrInputChanged
+	}
+
+	if records != nil {
+		return errors.Join(cp.spoolInput(records), cp.writeSpec(spec))
+	}
+	if spec.RecordsPath == "" {
+		if _, err := os.Stat(cp.inputPath()); err != nil {
+			return ErrNoRecords
+		}
+	}
+	return cp.writeSpec(spec)
+}
+
+// Status reports how far a batch has progressed.
+func (r *Runner) Status(ctx context.Context, batchID string) (*Progress, error) {
+	cp, spec, err := r.lookup(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := cp.readResults()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch manifest: %v", err)
+	}
+
+	progress := &Progress{
+		BatchID:      batchID,
+		Done:         cp.isDone(),
+		ManifestPath: spec.ManifestPath,
+	}
+	for _, res := range results {
+		if res.Status == ResultSuccess {
+			progress.Succeeded++
+		} else {
+			progress.Failed++
+		}
+	}
+	return progress, nil
+}
+
+// Manifest writes the manifest of a batch as NDJSON ordered by record index,
+// with only the latest result for records that were retried.
+func (r *Runner) Manifest(ctx context.Context, batchID string, w io.Writer) error {
+	cp, _, err := r.lookup(batchID)
+	if err != nil {
+		return err
+	}
+	return writeManifest(cp, w)
+}
+
+func (r *Runner) lookup(batchID string) (checkpoint, *Spec, error) {
+	if !batchIDRegex.MatchString(batchID) {
+		return checkpoint{}, nil, ErrInvalidBatchID
+	}
+	cp := r.checkpoint(batchID)
+	spec, err := cp.readSpec()
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return cp, nil, err
+	}
+	return cp, spec, nil
+}
+
+func (r *Runner) checkpoint(batchID string) checkpoint {
+	return checkpoint{dir: r.dir, batchID: batchID}
+}
+
+func (r *Runner) markRunning(batchID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running[batchID] {
+		return false
+	}
+	r.running[batchID] = true
+	return true
+}
+
+func (r *Runner) markStopped(batchID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, batchID)
+}
+
+func (r *Runner) openRecords(ctx context.Context, cp checkpoint, spec *Spec) (io.Reader, func(), error) {
+	if spec.RecordsPath != "" {
+		reader, err := (*r.fileStore).GetDocument(ctx, &templatestore.GetDocumentRequest{
+			FilePath:   spec.RecordsPath,
+			FileS3Path: spec.RecordsPath,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open batch records: %v", err)
+		}
+		return reader, func() {
+			if c, ok := reader.(io.Closer); ok {
+				c.Close()
+			}
+		}, nil
+	}
+
+	f, err := os.Open(cp.inputPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open spooled batch records: %v", err)
+	}
+	return f, func() { f.Close() }, nil
+}
+
+func (r *Runner) process(ctx context.Context, cp checkpoint, spec *Spec) {
+	defer r.markStopped(spec.BatchID)
+	startTime := time.Now()
+	logFields := map[string]any{"batch_id": spec.BatchID}
+
+	completed, err := cp.readResults()
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to read batch manifest", err, logFields)
+		return
+	}
+
+	reader, closeReader, err := r.openRecords(ctx, cp, spec)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to open batch records", err, logFields)
+		return
+	}
+	defer closeReader()
+
+	manifest, err := cp.openManifest()
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to open batch manifest", err, logFields)
+		return
+	}
+
+	var wg sync.WaitGroup
+	lines := bufio.NewReaderSize(reader, 64*1024)
+
+	index := -1
+	skipped := 0
+	var readErr error
+	for {
+		line, tooLong, err := readLine(lines, r.maxRecordSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 && !tooLong {
+			continue
+		}
+		index++
+		if res, ok := completed[index]; ok && res.Status == ResultSuccess {
+			skipped++
+			continue
+		}
+		if tooLong {
+			r.record(ctx, manifest, Result{Index: index, Status: ResultFailed, Error: fmt.Sprintf("record is larger than %d bytes", r.maxRecordSize)})
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			r.record(ctx, manifest, Result{Index: index, Status: ResultFailed, Error: "invalid record: " + err.Error()})
+			continue
+		}
+
+		r.sem <- struct{}{}
+		wg.Add(1)
+		go func(index int, record Record) {
+			defer func() {
+				<-r.sem
+				wg.Done()
+			}()
+			r.record(ctx, manifest, r.render(ctx, spec, index, &record))
+		}(index, record)
+	}
+	wg.Wait()
+
+	if err := manifest.Close(); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to close batch manifest", err, logFields)
+		return
+	}
+	if readErr != nil {
+		// leave the batch unfinished so it is picked up again on resume
+		svcUtils.Logger.Error(ctx, "failed to read batch records", readErr, logFields)
+		return
+	}
+
+	if spec.ManifestPath != "" {
+		if err := r.storeManifest(ctx, cp, spec.ManifestPath); err != nil {
+			svcUtils.Logger.Error(ctx, "failed to store batch manifest", err, logFields)
+			return
+		}
+	}
+	if err := cp.markDone(); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to mark batch done", err, logFields)
+		return
+	}
+
+	duration := time.Since(startTime)
+	svcUtils.Logger.Info(ctx, "batch completed :: ", map[string]any{"batch_id": spec.BatchID, "records": index + 1, "skipped": skipped, "duration": duration})
+}
+
+func (r *Runner) record(ctx context.Context, manifest *manifestWriter, res Result) {
+	if err := manifest.write(res); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to write batch manifest entry", err, map[string]any{"index": res.Index})
+	}
+}
+
+func (r *Runner) render(ctx context.Context, spec *Spec, index int, record *Record) (res Result) {
+	startTime := time.Now()
+	res = Result{Index: index, ID: record.ID, OutputFilePath: record.OutputFilePath, Status: ResultSuccess}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err := fmt.Errorf("panic: %v and stacktrace %s", rec, string(debug.Stack()))
+			svcUtils.Logger.Error(ctx, "recovered from panic in batch record", err, map[string]any{"batch_id": spec.BatchID, "index": index})
+			res.Status = ResultFailed
+			res.Error = fmt.Sprintf("panic: %v", rec)
+		}
+		res.DurationMs = time.Since(startTime).Milliseconds()
+	}()
+
+	if record.OutputFilePath == "" {
+		res.Status = ResultFailed
+		res.Error = "output_file_path is required"
+		return res
+	}
+
+	content := record.Content
+	if len(content) == 0 {
+		content = json.RawMessage(`{}`)
+	}
+	pdfParams := spec.PdfParams
+	if pdfParams == nil {
+		pdfParams = &generateDoc.PDFParams{}
+	}
+
+	req := &generateDoc.PDFDto{
+		ReqId:              fmt.Sprintf("%s-%d", spec.BatchID, index),
+		InputTemplatePath:  spec.InputFilePath,
+		InputTemplateUUID:  spec.InputTemplateUUID,
+		OutputTemplatePath: record.OutputFilePath,
+		Content:            content,
+		ViewPort:           spec.Viewport,
+		PdfParams:          pdfParams,
+		ClientID:           spec.ClientID,
+	}
+	if record.SignPdf {
+		req.SignParams = &generateDoc.SignParams{SignPdf: true, CertConfigKey: spec.CertConfigKey}
+	}
+
+	if err := r.generate(ctx, req); err != nil {
+		res.Status = ResultFailed
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// readLine returns the next line of r without its newline, and io.EOF once
+// there are none left. A line longer than max is read to its end and
+// reported as too long instead of returned.
+func readLine(r *bufio.Reader, max int) ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(bytes.TrimSuffix(chunk, []byte("\n")))+len(line) > max {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(line) > 0 || tooLong):
+			return line, tooLong, nil
+		case err != nil:
+			return nil, false, err
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), tooLong, nil
+	}
+}
+
+func (r *Runner) storeManifest(ctx context.Context, cp checkpoint, path string) error {
+	var buf bytes.Buffer
+	if err := writeManifest(cp, &buf); err != nil {
+		return err
+	}
+
+	var reader io.Reader = &buf
+	_, err := (*r.fileStore).PutDocument(ctx, &templatestore.PostDocumentRequest{
+		FilePath:   path,
+		FileS3Path: path,
+	}, &reader)
+	return err
+}
+
+func writeManifest(cp checkpoint, w io.Writer) error {
+	results, err := cp.readResults()
+	if err != nil {
+		return fmt.Errorf("failed to read batch manifest: %v", err)
+	}
+
+	indexes := make([]int, 0, len(results))
+	for i := range results {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	enc := json.NewEncoder(w)
+	for _, i := range indexes {
+		if err := enc.Encode(results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner whose renders only record which outputs
+// were asked for, failing those listed in fail.
+func newTestRunner(t *testing.T, dir string, fail ...string) (*Runner, func() []string) {
+	var fileStore templatestore.StorageAdapter = &templatestore.DiskTemplateStorage{}
+	r, err := NewRunner(Config{Concurrency: 2, CheckpointDir: dir}, nil, &fileStore)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var rendered []string
+	r.generate = func(ctx context.Context, req *generateDoc.PDFDto) error {
+		mu.Lock()
+		defer mu.Unlock()
+		rendered = append(rendered, req.OutputTemplatePath)
+		for _, f := range fail {
+			if f == req.OutputTemplatePath {
+				return errors.New("render failed")
+			}
+		}
+		return nil
+	}
+	return r, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), rendered...)
+	}
+}
+
+func records(outputs ...string) string {
+	var b strings.Builder
+	for _, out := range outputs {
+		fmt.Fprintf(&b, `{"content":{"n":1},"output_file_path":%q}`+"\n", out)
+	}
+	return b.String()
+}
+
+func waitDone(t *testing.T, r *Runner, batchID string) *Progress {
+	var progress *Progress
+	require.Eventually(t, func() bool {
+		var err error
+		progress, err = r.Status(context.Background(), batchID)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return err == nil && progress.Done && !r.running[batchID]
+	}, 5*time.Second, 10*time.Millisecond)
+	return progress
+}
+
+func TestBatchResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// a batch interrupted after its first record succeeded and its second
+	// failed
+	cp := checkpoint{dir: dir, batchID: "b1"}
+	require.NoError(t, cp.writeSpec(&Spec{BatchID: "b1", InputTemplateUUID: "t1"}))
+	require.NoError(t, cp.spoolInput(strings.NewReader(records("out/0.pdf", "out/1.pdf", "out/2.pdf"))))
+	manifest, err := cp.openManifest()
+	require.NoError(t, err)
+	require.NoError(t, manifest.write(Result{Index: 0, OutputFilePath: "out/0.pdf", Status: ResultSuccess}))
+	require.NoError(t, manifest.write(Result{Index: 1, OutputFilePath: "out/1.pdf", Status: ResultFailed, Error: "render failed"}))
+	require.NoError(t, manifest.Close())
+
+	r, rendered := newTestRunner(t, dir)
+	require.NoError(t, r.Start(ctx))
+	progress := waitDone(t, r, "b1")
+
+	assert.ElementsMatch(t, []string{"out/1.pdf", "out/2.pdf"}, rendered(), "only records without a success are redone")
+	assert.Equal(t, 3, progress.Succeeded)
+	assert.Equal(t, 0, progress.Failed)
+
+	var out strings.Builder
+	require.NoError(t, r.Manifest(ctx, "b1", &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[1], `"index":1,"output_file_path":"out/1.pdf","status":"success"`)
+
+	// done batches are not resumed or resubmitted
+	again, rendered := newTestRunner(t, dir)
+	require.NoError(t, again.Start(ctx))
+	_, err = again.Submit(ctx, &Spec{BatchID: "b1"}, nil)
+	assert.ErrorIs(t, err, ErrBatchDone)
+	assert.Empty(t, rendered())
+}
+
+func TestBatchRejectsNewInputForExistingBatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	r, rendered := newTestRunner(t, dir, "out/1.pdf")
+	_, err := r.Submit(ctx, &Spec{BatchID: "b2"}, strings.NewReader(records("out/0.pdf", "out/1.pdf")))
+	require.NoError(t, err)
+	progress := waitDone(t, r, "b2")
+	assert.Equal(t, 1, progress.Failed)
+
+	// an unfinished batch keeps the input its manifest was written for
+	cp := checkpoint{dir: dir, batchID: "b2"}
+	require.NoError(t, os.Remove(cp.donePath()))
+	_, err = r.Submit(ctx, &Spec{BatchID: "b2"}, strings.NewReader(records("out/other.pdf")))
+	assert.ErrorIs(t, err, ErrInputChanged)
+	_, err = r.Submit(ctx, &Spec{BatchID: "b2", RecordsPath: "records/other.ndjson"}, nil)
+	assert.ErrorIs(t, err, ErrInputChanged)
+
+	// resuming without a body retries the failed record only
+	_, err = r.Submit(ctx, &Spec{BatchID: "b2"}, nil)
+	require.NoError(t, err)
+	waitDone(t, r, "b2")
+	assert.Equal(t, []string{"out/1.pdf"}, rendered()[2:])
+}
+
+func TestBatchFailsOversizeRecordAndContinues(t *testing.T) {
+	ctx := context.Background()
+	r, rendered := newTestRunner(t, t.TempDir())
+	r.maxRecordSize = 100
+
+	input := records("out/0.pdf") +
+		`{"content":{"text":"` + strings.Repeat("x", 100<<10) + `"},"output_file_path":"out/1.pdf"}` + "\n" +
+		"not json\n" +
+		records("out/3.pdf")
+	_, err := r.Submit(ctx, &Spec{BatchID: "b3"}, strings.NewReader(input))
+	require.NoError(t, err)
+	progress := waitDone(t, r, "b3")
+
+	assert.ElementsMatch(t, []string{"out/0.pdf", "out/3.pdf"}, rendered())
+	assert.Equal(t, 2, progress.Succeeded)
+	assert.Equal(t, 2, progress.Failed)
+
+	results, err := checkpoint{dir: r.dir, batchID: "b3"}.readResults()
+	require.NoError(t, err)
+	assert.Equal(t, "record is larger than 100 bytes", results[1].Error)
+	assert.Contains(t, results[2].Error, "invalid record")
+}
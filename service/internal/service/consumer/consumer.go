@@ -0,0 +1,214 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+type Config struct {
+	InputTopic      string
+	ResultTopic     string
+	DeadLetterTopic string
+	// Concurrency is the number of messages handled at once. It should not
+	// exceed the browser tab pool.
+	Concurrency int
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on each retry.
+	Backoff time.Duration
+}
+
+// deadLetter is published to the dead-letter topic for messages that could
+// not be handled within MaxAttempts.
+type deadLetter struct {
+	Message  json.RawMessage `json:"message"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt string          `json:"failed_at"`
+}
+
+// Consumer reads PDFMessages from a Queue, generates and stores each PDF and
+// publishes a PDFResultMessage.
+type Consumer struct {
+	queue    Queue
+	conf     Config
+	generate func(ctx context.Context, req *generateDoc.PDFDto) error
+}
+
+func NewConsumer(conf Config, queue Queue, templateStore, fileStore *templatestore.StorageAdapter) *Consumer {
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 1
+	}
+
+	return &Consumer{
+		queue: queue,
+		conf:  conf,
+		generate: func(ctx context.Context, req *generateDoc.PDFDto) error {
+			return generateDoc.GeneratePDF(ctx, req, templateStore, fileStore)
+		},
+	}
+}
+
+// Run consumes the input topic until ctx is done.
+func (c *Consumer) Run(ctx context.Context) error {
+	deliveries, err := c.queue.Subscribe(ctx, c.conf.InputTopic)
+	if err != nil {
+		return err
+	}
+	svcUtils.Logger.Info(ctx, "queue consumer started", map[string]any{"topic": c.conf.InputTopic, "concurrency": c.conf.Concurrency})
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.conf.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				c.handle(ctx, d)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (c *Consumer) handle(ctx context.Context, d *Delivery) {
+	defer func() {
+		if err := d.Ack(); err != nil {
+			svcUtils.Logger.Error(ctx, "failed to ack message", err, nil)
+		}
+	}()
+
+	startTime := time.Now()
+	var msg generateDoc.PDFMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil {
+		// retrying cannot fix a malformed payload
+		c.deadLetter(ctx, d.Body, fmt.Errorf("invalid message: %v", err), 0)
+		return
+	}
+
+	result := &generateDoc.PDFResultMessage{
+		DocType:        msg.DocType,
+		ReqId:          msg.ReqId,
+		Status:         ResultSuccess,
+		OutputFilePath: msg.Data.OutputFilePath,
+	}
+
+	var err error
+	backoff := c.conf.Backoff
+	for result.Attempts < c.conf.MaxAttempts {
+		if result.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(backoff):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			backoff *= 2
+		}
+		result.Attempts++
+
+		if err = c.process(ctx, &msg); err == nil {
+			break
+		}
+		svcUtils.Logger.Error(ctx, "failed to process message", err, map[string]any{"req_id": msg.ReqId, "attempt": result.Attempts})
+	}
+	result.DurationMs = time.Since(startTime).Milliseconds()
+
+	if err != nil {
+		result.Status = ResultFailed
+		result.Error = err.Error()
+		c.deadLetter(ctx, d.Body, err, result.Attempts)
+	}
+	c.publishResult(ctx, result)
+}
+
+func (c *Consumer) process(ctx context.Context, msg *generateDoc.PDFMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			svcUtils.Logger.Error(ctx, "recovered from panic", fmt.Errorf("panic: %v and stacktrace %s", r, string(debug.Stack())), map[string]any{"req_id": msg.ReqId})
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if msg.Data.Template == "" {
+		return fmt.Errorf("template is required")
+	}
+	content := msg.Data.Content
+	if len(content) == 0 {
+		content = json.RawMessage(`{}`)
+	}
+	pdfParams := msg.Data.PdfParams
+	if pdfParams == nil {
+		pdfParams = &generateDoc.PDFParams{}
+	}
+
+	req := &generateDoc.PDFDto{
+		ReqId:              msg.ReqId,
+		InputTemplateUUID:  msg.Data.Template,
+		OutputTemplatePath: msg.Data.OutputFilePath,
+		Content:            content,
+		ViewPort:           msg.Data.ViewPort,
+		PdfParams:          pdfParams,
+	}
+	if msg.Data.SignParams != nil && msg.Data.SignParams.SignPdf {
+		req.SignParams = msg.Data.SignParams
+	}
+
+	return c.generate(ctx, req)
+}
+
+func (c *Consumer) publishResult(ctx context.Context, result *generateDoc.PDFResultMessage) {
+	if c.conf.ResultTopic == "" {
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to marshal result message", err, map[string]any{"req_id": result.ReqId})
+		return
+	}
+	if err := c.queue.Publish(ctx, c.conf.ResultTopic, body); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to publish result message", err, map[string]any{"req_id": result.ReqId})
+	}
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, body []byte, cause error, attempts int) {
+	if c.conf.DeadLetterTopic == "" {
+		return
+	}
+	message := json.RawMessage(body)
+	if !json.Valid(body) {
+		message, _ = json.Marshal(string(body))
+	}
+
+	letter, err := json.Marshal(deadLetter{
+		Message:  message,
+		Error:    cause.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to marshal dead letter", err, nil)
+		return
+	}
+	if err := c.queue.Publish(ctx, c.conf.DeadLetterTopic, letter); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to publish dead letter", err, nil)
+	}
+}
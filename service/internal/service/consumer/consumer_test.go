@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		wantStatus   string
+		wantAttempts int
+		deadLettered bool
+	}{
+		{
+			name:         "success_first_attempt",
+			wantStatus:   ResultSuccess,
+			wantAttempts: 1,
+		},
+		{
+			name:         "success_after_retry",
+			failures:     2,
+			wantStatus:   ResultSuccess,
+			wantAttempts: 3,
+		},
+		{
+			name:         "dead_lettered_after_max_attempts",
+			failures:     10,
+			wantStatus:   ResultFailed,
+			wantAttempts: 3,
+			deadLettered: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			queue := NewMemoryQueue(8)
+			defer queue.Close()
+
+			c := NewConsumer(Config{
+				InputTopic:      "in",
+				ResultTopic:     "out",
+				DeadLetterTopic: "dlq",
+				Concurrency:     2,
+				MaxAttempts:     3,
+				Backoff:         time.Millisecond,
+			}, queue, nil, nil)
+
+			var calls int32
+			c.generate = func(ctx context.Context, req *generateDoc.PDFDto) error {
+				assert.Equal(t, "template-1-uuid", req.InputTemplateUUID)
+				assert.Equal(t, "out/1.pdf", req.OutputTemplatePath)
+				if atomic.AddInt32(&calls, 1) <= tt.failures {
+					return errors.New("render failed")
+				}
+				return nil
+			}
+
+			results, err := queue.Subscribe(ctx, "out")
+			require.NoError(t, err)
+			deadLetters, err := queue.Subscribe(ctx, "dlq")
+			require.NoError(t, err)
+			go c.Run(ctx)
+
+			msg, err := json.Marshal(generateDoc.PDFMessage{
+				DocType: "pdf",
+				ReqId:   "req-1",
+				Data: generateDoc.PDFMessageData{
+					Template:       "template-1-uuid",
+					Content:        json.RawMessage(`{"title":"hello"}`),
+					OutputFilePath: "out/1.pdf",
+				},
+			})
+			require.NoError(t, err)
+			require.NoError(t, queue.Publish(ctx, "in", msg))
+
+			var result generateDoc.PDFResultMessage
+			select {
+			case d := <-results:
+				require.NoError(t, json.Unmarshal(d.Body, &result))
+			case <-ctx.Done():
+				t.Fatal("no result published")
+			}
+			assert.Equal(t, "req-1", result.ReqId)
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantAttempts, result.Attempts)
+
+			if tt.deadLettered {
+				select {
+				case d := <-deadLetters:
+					var letter deadLetter
+					require.NoError(t, json.Unmarshal(d.Body, &letter))
+					assert.Equal(t, "render failed", letter.Error)
+					assert.JSONEq(t, string(msg), string(letter.Message))
+				case <-ctx.Done():
+					t.Fatal("no dead letter published")
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryQueuePublishDuringClose(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 50; i++ {
+		queue := NewMemoryQueue(1)
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if err := queue.Publish(ctx, "in", []byte("msg")); err != nil {
+						assert.ErrorIs(t, err, ErrQueueClosed)
+						return
+					}
+				}
+			}()
+		}
+		deliveries, err := queue.Subscribe(ctx, "in")
+		require.NoError(t, err)
+		<-deliveries
+		require.NoError(t, queue.Close())
+		wg.Wait()
+
+		for range deliveries {
+		}
+		_, err = queue.Subscribe(ctx, "in")
+		assert.ErrorIs(t, err, ErrQueueClosed)
+	}
+}
+
+func TestConsumerAcceptsLegacyMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	queue := NewMemoryQueue(8)
+	defer queue.Close()
+	c := NewConsumer(Config{InputTopic: "in", ResultTopic: "out", Concurrency: 1, MaxAttempts: 1}, queue, nil, nil)
+	requests := make(chan *generateDoc.PDFDto, 1)
+	c.generate = func(ctx context.Context, req *generateDoc.PDFDto) error {
+		requests <- req
+		return nil
+	}
+	go c.Run(ctx)
+
+	// the payload producers sent before the message had snake_case fields
+	legacy := `{"DocType":"pdf","ReqId":"req-1","Data":{"Template":"template-1-uuid","Content":"eyJ0aXRsZSI6ImhlbGxvIn0=","ViewPort":{"width":800},"PdfParams":{"landscape":true}}}`
+	require.NoError(t, queue.Publish(ctx, "in", []byte(legacy)))
+
+	select {
+	case req := <-requests:
+		assert.Equal(t, "req-1", req.ReqId)
+		assert.Equal(t, "template-1-uuid", req.InputTemplateUUID)
+		assert.JSONEq(t, `{"title":"hello"}`, string(req.Content))
+		assert.Equal(t, int32(800), req.ViewPort.Width)
+		assert.True(t, req.PdfParams.Landscape)
+	case <-ctx.Done():
+		t.Fatal("legacy message not processed")
+	}
+}
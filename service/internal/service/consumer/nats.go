@@ -0,0 +1,59 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSQueue is a Queue on core NATS. Subscriptions join a queue group so that
+// several service instances share the input topic instead of each receiving
+// every message. Core NATS has no acknowledgements, delivery is at most once.
+type NATSQueue struct {
+	conn  *nats.Conn
+	group string
+}
+
+func NewNATSQueue(url, queueGroup string) (*NATSQueue, error) {
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	return &NATSQueue{conn: conn, group: queueGroup}, nil
+}
+
+func (n *NATSQueue) Subscribe(ctx context.Context, topic string) (<-chan *Delivery, error) {
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := n.conn.ChanQueueSubscribe(topic, n.group, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %v", topic, err)
+	}
+
+	out := make(chan *Delivery)
+	go func() {
+		defer close(out)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-msgs:
+				select {
+				case out <- &Delivery{Body: msg.Data, Ack: func() error { return nil }}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (n *NATSQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	return n.conn.Publish(topic, body)
+}
+
+func (n *NATSQueue) Close() error {
+	return n.conn.Drain()
+}
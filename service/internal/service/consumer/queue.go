@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Delivery is a single message received from a Queue.
+type Delivery struct {
+	Body []byte
+	// Ack tells the broker the message has been handled, successfully or by
+	// dead-lettering it. Drivers without acknowledgements may no-op.
+	Ack func() error
+}
+
+// Queue is the broker abstraction the consumer runs on. Implementations must
+// be safe for concurrent use.
+type Queue interface {
+	// Subscribe starts receiving messages published to topic. The returned
+	// channel is closed when ctx is done or the queue is closed.
+	Subscribe(ctx context.Context, topic string) (<-chan *Delivery, error)
+	Publish(ctx context.Context, topic string, body []byte) error
+	Close() error
+}
+
+var ErrQueueClosed = errors.New("queue is closed")
+
+// MemoryQueue is an in-process Queue backed by buffered channels. It is meant
+// for tests and single instance setups; messages are lost on restart.
+//
+// The topic channels are never closed, as publishers may still be sending
+// on them; closing the queue closes done instead.
+type MemoryQueue struct {
+	mu     sync.Mutex
+	topics map[string]chan *Delivery
+	closed bool
+	done   chan struct{}
+	size   int
+}
+
+func NewMemoryQueue(size int) *MemoryQueue {
+	return &MemoryQueue{topics: map[string]chan *Delivery{}, done: make(chan struct{}), size: size}
+}
+
+func (m *MemoryQueue) topic(name string) chan *Delivery {
+	ch, ok := m.topics[name]
+	if !ok {
+		ch = make(chan *Delivery, m.size)
+		m.topics[name] = ch
+	}
+	return ch
+}
+
+func (m *MemoryQueue) Subscribe(ctx context.Context, topic string) (<-chan *Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrQueueClosed
+	}
+	src := m.topic(topic)
+
+	out := make(chan *Delivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			case d := <-src:
+				select {
+				case out <- d:
+				case <-ctx.Done():
+					return
+				case <-m.done:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *MemoryQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrQueueClosed
+	}
+	ch := m.topic(topic)
+	m.mu.Unlock()
+
+	d := &Delivery{Body: body, Ack: func() error { return nil }}
+	select {
+	case ch <- d:
+		return nil
+	case <-m.done:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MemoryQueue) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	return nil
+}
+
+const (
+	DriverMemory = "memory"
+	DriverNATS   = "nats"
+)
+
+// NewQueue builds the Queue for the configured driver.
+func NewQueue(driver, url, queueGroup string) (Queue, error) {
+	switch driver {
+	case DriverMemory:
+		return NewMemoryQueue(1024), nil
+	case DriverNATS:
+		return NewNATSQueue(url, queueGroup)
+	default:
+		return nil, errors.New("unsupported queue driver: " + driver)
+	}
+}
@@ -0,0 +1,40 @@
+package generateDoc
+
+import "github.com/Zomato/espresso/lib/browser_manager"
+
+var (
+	templateAllowlists map[string]*browser_manager.Allowlist
+	clientAllowlists   map[string]*browser_manager.Allowlist
+)
+
+// SetAllowlists sets the allowlists combined with the global one for renders
+// of a template, keyed by template UUID or path, and for renders requested
+// by an API client, keyed by client ID.
+func SetAllowlists(templates, clients map[string]*browser_manager.Allowlist) {
+	templateAllowlists = templates
+	clientAllowlists = clients
+}
+
+// clientAllowlistID is req.ClientID if the client has its own allowlist.
+func clientAllowlistID(req *PDFDto) string {
+	if clientAllowlists[req.ClientID] == nil {
+		return ""
+	}
+	return req.ClientID
+}
+
+func renderAllowlists(req *PDFDto) []*browser_manager.Allowlist {
+	var lists []*browser_manager.Allowlist
+
+	template := req.InputTemplateUUID
+	if template == "" {
+		template = req.InputTemplatePath
+	}
+	if list := templateAllowlists[template]; template != "" && list != nil {
+		lists = append(lists, list)
+	}
+	if list := clientAllowlists[req.ClientID]; req.ClientID != "" && list != nil {
+		lists = append(lists, list)
+	}
+	return lists
+}
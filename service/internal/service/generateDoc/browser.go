@@ -0,0 +1,11 @@
+package generateDoc
+
+import "github.com/Zomato/espresso/lib/browser_manager"
+
+var browser *browser_manager.Manager
+
+// SetBrowser sets the browsers GeneratePDF renders in. It must be called
+// before any PDF is generated.
+func SetBrowser(m *browser_manager.Manager) {
+	browser = m
+}
@@ -0,0 +1,93 @@
+package generateDoc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/service/pdfcache"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+var renderCache *pdfcache.Cache
+
+// SetCache puts c in front of rendering in GeneratePDF. Passing nil turns
+// caching off.
+func SetCache(c *pdfcache.Cache) {
+	renderCache = c
+}
+
+// cacheKey returns the render cache key for req, or "" when the request must
+// not be cached, e.g. because the template version cannot be determined.
+func cacheKey(ctx context.Context, req *PDFDto, templateStoreAdapter *templatestore.StorageAdapter, cacheSigned bool) string {
+	templateID, version, err := templateVersion(ctx, req, templateStoreAdapter)
+	if err != nil {
+		svcUtils.Logger.Info(ctx, "not caching render", map[string]any{"req_id": req.ReqId, "reason": err.Error()})
+		return ""
+	}
+
+	signedWith := ""
+	if cacheSigned {
+		signedWith = req.SignParams.CertConfigKey
+	}
+
+	key, err := pdfcache.Key(pdfcache.KeyInput{
+		TemplateID:      templateID,
+		TemplateVersion: version,
+		Content:         req.Content,
+		Params: struct {
+			PdfParams *PDFParams      `json:"pdf_params"`
+			ViewPort  *ViewportConfig `json:"viewport"`
+			// a client's allowlist can change which images are fetched
+			ClientID string `json:"client_id,omitempty"`
+			Fonts    string `json:"fonts,omitempty"`
+		}{req.PdfParams, req.ViewPort, clientAllowlistID(req), fontsVersion()},
+		SignedWith: signedWith,
+	})
+	if err != nil {
+		svcUtils.Logger.Info(ctx, "not caching render", map[string]any{"req_id": req.ReqId, "reason": err.Error()})
+		return ""
+	}
+	return key
+}
+
+// templateVersion identifies the exact template revision a request renders,
+// mirroring how renderer.GetHtmlPdf picks the template source.
+func templateVersion(ctx context.Context, req *PDFDto, templateStoreAdapter *templatestore.StorageAdapter) (string, string, error) {
+	var adapter templatestore.StorageAdapter
+	if templateStoreAdapter != nil {
+		adapter = *templateStoreAdapter
+	}
+
+	switch adapter.(type) {
+	case nil, *templatestore.StreamStorage:
+		if len(req.InputFileBytes) == 0 {
+			return "", "", fmt.Errorf("no template bytes")
+		}
+		// the bytes are the template, their hash is the version
+		sum := sha256.Sum256(req.InputFileBytes)
+		return "bytes", hex.EncodeToString(sum[:]), nil
+	case *templatestore.DiskTemplateStorage:
+		info, err := os.Stat(req.InputTemplatePath)
+		if err != nil {
+			return "", "", err
+		}
+		return "disk:" + req.InputTemplatePath, fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+	default:
+		if req.InputTemplateUUID == "" {
+			return "", "", fmt.Errorf("template store cannot report a version for this template")
+		}
+		resp, err := adapter.GetTemplateContent(ctx, &templatestore.GetTemplateContentRequest{TemplateUUID: req.InputTemplateUUID})
+		if err != nil {
+			return "", "", err
+		}
+		if resp.UpdatedAt.IsZero() {
+			return "", "", fmt.Errorf("template has no updated_at")
+		}
+		return "uuid:" + req.InputTemplateUUID, resp.UpdatedAt.UTC().Format(time.RFC3339Nano), nil
+	}
+}
@@ -1,5 +1,17 @@
 package generateDoc
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Stage names reported through PDFDto.OnStage while a PDF is being produced.
+const (
+	StageRendering = "rendering"
+	StageSigning   = "signing"
+	StageUploaded  = "uploaded"
+)
+
 type PDFDto struct {
 	ReqId              string
 	InputTemplatePath  string
@@ -11,19 +23,114 @@ type PDFDto struct {
 	PdfParams          *PDFParams
 	SignParams         *SignParams
 	OutputFileBytes    []byte
+	// FontsUsed lists the families of the registered fonts the render used.
+	// It is empty for renders served from the cache.
+	FontsUsed []string `json:"-"`
+	// Images reports every URL found in the content and what became of it.
+	// It is empty for renders served from the cache.
+	Images []ImageReport `json:"-"`
+	// BypassCache skips the render cache lookup and store for this request.
+	BypassCache bool
+	// ClientID identifies the API client, whose allowlist applies to the
+	// render. Set from a trusted header, never from the request body.
+	ClientID string `json:"client_id,omitempty"`
+	// OnStage, if set, is called as generation moves through each stage.
+	OnStage func(stage string) `json:"-"`
+}
+
+func (p *PDFDto) reportStage(stage string) {
+	if p.OnStage != nil {
+		p.OnStage(stage)
+	}
 }
 
 type PDFMessageData struct {
-	Template  string
-	Content   []byte
-	ViewPort  *ViewportConfig
-	PdfParams *PDFParams
+	// Template is the UUID of the template in the template store.
+	Template       string          `json:"template"`
+	Content        json.RawMessage `json:"content,omitempty"`
+	ViewPort       *ViewportConfig `json:"viewport,omitempty"`
+	PdfParams      *PDFParams      `json:"pdf_params,omitempty"`
+	OutputFilePath string          `json:"output_file_path,omitempty"`
+	SignParams     *SignParams     `json:"sign_params,omitempty"`
+}
+
+// UnmarshalJSON also accepts the payload producers sent before the fields
+// had snake_case names, with Go field names as keys and Content as base64.
+func (d *PDFMessageData) UnmarshalJSON(b []byte) error {
+	type data PDFMessageData
+	var current data
+	if err := json.Unmarshal(b, &current); err != nil {
+		return err
+	}
+	var legacy struct {
+		PdfParams      *PDFParams  `json:"PdfParams"`
+		OutputFilePath string      `json:"OutputFilePath"`
+		SignParams     *SignParams `json:"SignParams"`
+	}
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return err
+	}
+	if current.PdfParams == nil {
+		current.PdfParams = legacy.PdfParams
+	}
+	if current.OutputFilePath == "" {
+		current.OutputFilePath = legacy.OutputFilePath
+	}
+	if current.SignParams == nil {
+		current.SignParams = legacy.SignParams
+	}
+	// content is a JSON object; a string is the base64 of one
+	if len(current.Content) > 0 && current.Content[0] == '"' {
+		var content []byte
+		if err := json.Unmarshal(current.Content, &content); err != nil {
+			return fmt.Errorf("content is neither an object nor base64: %v", err)
+		}
+		current.Content = content
+	}
+	*d = PDFMessageData(current)
+	return nil
 }
 
 type PDFMessage struct {
-	DocType string
-	ReqId   string
-	Data    PDFMessageData
+	DocType string         `json:"doc_type"`
+	ReqId   string         `json:"req_id"`
+	Data    PDFMessageData `json:"data"`
+}
+
+// UnmarshalJSON also accepts the DocType and ReqId keys of the payload
+// producers sent before the fields had snake_case names.
+func (m *PDFMessage) UnmarshalJSON(b []byte) error {
+	type message PDFMessage
+	var current message
+	if err := json.Unmarshal(b, &current); err != nil {
+		return err
+	}
+	var legacy struct {
+		DocType string `json:"DocType"`
+		ReqId   string `json:"ReqId"`
+	}
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return err
+	}
+	if current.DocType == "" {
+		current.DocType = legacy.DocType
+	}
+	if current.ReqId == "" {
+		current.ReqId = legacy.ReqId
+	}
+	*m = PDFMessage(current)
+	return nil
+}
+
+// PDFResultMessage is published once a PDFMessage has been handled.
+type PDFResultMessage struct {
+	DocType        string `json:"doc_type"`
+	ReqId          string `json:"req_id"`
+	Status         string `json:"status"`
+	OutputFilePath string `json:"output_file_path,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Attempts       int    `json:"attempts"`
+	DurationMs     int64  `json:"duration_ms"`
 }
 
 type ImageMessageData struct {
@@ -61,6 +168,33 @@ type PDFParams struct {
 	PaperWidth          float64 `json:"paper_width,omitempty"`
 	PaperHeight         float64 `json:"paper_height,omitempty"`
 	IsSinglePage        bool    `json:"is_single_page,omitempty"`
+	// Wait overrides the waits set in the template's espresso-wait meta tag.
+	Wait *WaitParams `json:"wait,omitempty"`
+	// Images overrides how prefetched images are shrunk, as set in the
+	// template's espresso-images meta tag.
+	Images *ImageParams `json:"images,omitempty"`
+	// ImagePolicy is lenient, strict or placeholder, and decides what
+	// happens to images that cannot be inlined.
+	ImagePolicy string `json:"image_policy,omitempty"`
+}
+
+// ImageParams shrink the images inlined from the content before rendering.
+type ImageParams struct {
+	MaxDimension  int     `json:"max_dimension,omitempty"` // pixels, longest side
+	DPI           float64 `json:"dpi,omitempty"`           // pixels per inch of the paper's longest side
+	Quality       int     `json:"quality,omitempty"`       // JPEG quality, 1-100
+	StripMetadata bool    `json:"strip_metadata,omitempty"`
+	RasterizeSVG  bool    `json:"rasterize_svg,omitempty"` // draw SVGs as PNGs
+}
+
+// WaitParams decide what the page must finish loading before it is printed.
+type WaitParams struct {
+	Until         string `json:"until,omitempty"` // load | domcontentloaded
+	NetworkIdleMs int    `json:"network_idle_ms,omitempty"`
+	Selector      string `json:"selector,omitempty"`
+	ReadyFlag     bool   `json:"ready_flag,omitempty"` // wait for window.espressoReady === true
+	Fonts         bool   `json:"fonts,omitempty"`
+	TimeoutMs     int    `json:"timeout_ms,omitempty"`
 }
 type ViewportConfig struct {
 	Width             int32   `json:"width,omitempty"`
@@ -72,6 +206,9 @@ type ViewportConfig struct {
 type SignParams struct {
 	SignPdf       bool   `json:"sign_pdf,omitempty"`
 	CertConfigKey string `json:"cert_config_key,omitempty"`
+	// CacheSigned allows the signed output itself to be cached and served
+	// again without re-signing.
+	CacheSigned bool `json:"cache_signed,omitempty"`
 }
 
 type TemplateListData struct {
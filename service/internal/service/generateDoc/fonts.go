@@ -0,0 +1,37 @@
+package generateDoc
+
+import "github.com/Zomato/espresso/lib/renderer"
+
+var fonts *renderer.FontRegistry
+
+// SetFonts sets the font registry whose fonts every render can use.
+func SetFonts(registry *renderer.FontRegistry) {
+	fonts = registry
+}
+
+// Fonts returns the font registry set with SetFonts, or nil.
+func Fonts() *renderer.FontRegistry {
+	return fonts
+}
+
+// fontsVersion changes whenever a font is added, since a new face can change
+// how a cached render would look.
+func fontsVersion() string {
+	if fonts == nil {
+		return ""
+	}
+	return fonts.Version()
+}
+
+// fontFamilies lists the families of the faces a render used.
+func fontFamilies(report *renderer.RenderReport) []string {
+	var families []string
+	seen := map[string]bool{}
+	for _, f := range report.FontsUsed {
+		if !seen[f.Family] {
+			seen[f.Family] = true
+			families = append(families, f.Family)
+		}
+	}
+	return families
+}
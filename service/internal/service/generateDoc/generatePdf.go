@@ -73,21 +73,55 @@ func GeneratePDF(ctx context.Context, req *PDFDto, templateStoreAdapter *templat
 	}
 
 	pdfProps := renderer.GetHtmlPdfInput{
+		Browser: browser,
 		TemplateRequest: templatestore.GetTemplateRequest{
 			TemplatePath:   req.InputTemplatePath,
 			TemplateS3Path: req.InputTemplatePath,
 			TemplateBytes:  req.InputFileBytes,
 			TemplateUUID:   req.InputTemplateUUID,
 		},
-		Data:         content,
-		ViewPort:     viewPort,
-		PdfParams:    pdfSettings,
-		IsSinglePage: pdfParams.IsSinglePage,
+		Data:          content,
+		ViewPort:      viewPort,
+		PdfParams:     pdfSettings,
+		IsSinglePage:  pdfParams.IsSinglePage,
+		Wait:          getWaitOptions(pdfParams),
+		Images:        getImageOptions(pdfParams),
+		ImageStores:   imageStores,
+		ImagePolicy:   getImagePolicy(pdfParams),
+		RenderTimeout: time.Duration(viper.GetInt("browser.render_timeout")) * time.Millisecond,
+		Allowlists:    renderAllowlists(req),
+		Fonts:         fonts,
+		Report:        &renderer.RenderReport{},
 	}
 
-	pdfBytes, err := renderer.GetHtmlPdf(ctx, &pdfProps, templateStoreAdapter)
-	if err != nil {
-		return fmt.Errorf("failed to generate pdf: %v", err)
+	// Signed outputs are only cached when the caller opts in, otherwise the
+	// unsigned render is cached and signed afresh on every hit.
+	cacheSigned := toBeSigned && req.SignParams.CacheSigned
+	var key string
+	if renderCache != nil && !req.BypassCache {
+		key = cacheKey(ctx, req, templateStoreAdapter, cacheSigned)
+	}
+
+	var pdfBytes []byte
+	cached := false
+	if key != "" {
+		pdfBytes, cached = renderCache.Get(ctx, key)
+	}
+
+	if cached {
+		svcUtils.Logger.Info(ctx, "pdf served from cache :: ", map[string]any{"req_id": req.ReqId})
+	} else {
+		req.reportStage(StageRendering)
+		var err error
+		pdfBytes, err = renderer.GetHtmlPdf(ctx, &pdfProps, templateStoreAdapter)
+		req.Images = imageReports(pdfProps.Report)
+		if err != nil {
+			return fmt.Errorf("failed to generate pdf: %w", err)
+		}
+		if key != "" && !cacheSigned && !imagesFailed(pdfProps.Report) {
+			renderCache.Set(ctx, key, pdfBytes)
+		}
+		req.FontsUsed = fontFamilies(pdfProps.Report)
 	}
 
 	duration := time.Since(startTime)
@@ -95,18 +129,21 @@ func GeneratePDF(ctx context.Context, req *PDFDto, templateStoreAdapter *templat
 
 	duration = time.Since(startTime)
 
-	if toBeSigned {
+	if toBeSigned && !(cached && cacheSigned) {
+		req.reportStage(StageSigning)
 		credWg.Wait()
 
 		if credErr != nil {
 			return fmt.Errorf("failed to load signing credentials: %v", credErr)
 		}
 
-		pdfReader := bytes.NewReader(pdfBytes)
-		signedPDF, err := signer.SignPdfStream(ctx, pdfReader, credentials.Certificate, credentials.PrivateKey)
+		signedPDF, err := signer.SignPdfStream(ctx, bytes.NewReader(pdfBytes), credentials.Certificate, credentials.PrivateKey)
 		if err != nil {
 			return fmt.Errorf("failed to sign pdf using SignPdfStream: %v", err)
 		}
+		if key != "" && cacheSigned {
+			renderCache.Set(ctx, key, signedPDF)
+		}
 
 		pdfReader = bytes.NewReader(signedPDF)
 	} else {
@@ -127,6 +164,7 @@ func GeneratePDF(ctx context.Context, req *PDFDto, templateStoreAdapter *templat
 	if resp == "stream" {
 		req.OutputFileBytes = docReq.OutputFileBytes
 	}
+	req.reportStage(StageUploaded)
 
 	duration = time.Since(startTime)
 	svcUtils.Logger.Info(ctx, "uploaded to storage :: ", map[string]any{"duration": duration})
@@ -168,6 +206,37 @@ func createPdfSettingsFromParams(pdfParams *PDFParams) *proto.PagePrintToPDF {
 	return pdfSettings
 }
 
+func getWaitOptions(pdfParams *PDFParams) *renderer.WaitOptions {
+	if pdfParams == nil || pdfParams.Wait == nil {
+		return nil
+	}
+
+	wait := pdfParams.Wait
+	return &renderer.WaitOptions{
+		Until:       wait.Until,
+		NetworkIdle: time.Duration(wait.NetworkIdleMs) * time.Millisecond,
+		Selector:    wait.Selector,
+		ReadyFlag:   wait.ReadyFlag,
+		Fonts:       wait.Fonts,
+		Timeout:     time.Duration(wait.TimeoutMs) * time.Millisecond,
+	}
+}
+
+func getImageOptions(pdfParams *PDFParams) *renderer.ImageOptions {
+	if pdfParams == nil || pdfParams.Images == nil {
+		return nil
+	}
+
+	images := pdfParams.Images
+	return &renderer.ImageOptions{
+		MaxDimension:  images.MaxDimension,
+		DPI:           images.DPI,
+		Quality:       images.Quality,
+		StripMetadata: images.StripMetadata,
+		RasterizeSVG:  images.RasterizeSVG,
+	}
+}
+
 func getViewPort(viewPort *ViewportConfig) *browser_manager.ViewportConfig {
 
 	viewSettings := &browser_manager.ViewportConfig{ // default viewport settings for A4 page
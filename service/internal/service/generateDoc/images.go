@@ -0,0 +1,87 @@
+package generateDoc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Zomato/espresso/lib/renderer"
+)
+
+var (
+	imageStores *renderer.ImageStores
+	imagePolicy renderer.ImagePolicy
+)
+
+// SetImageStores sets where renders read store:// and s3:// images from.
+func SetImageStores(stores *renderer.ImageStores) {
+	imageStores = stores
+}
+
+// SetImagePolicy sets what happens to images that cannot be inlined, unless
+// a request picks its own mode.
+func SetImagePolicy(policy renderer.ImagePolicy) {
+	imagePolicy = policy
+}
+
+// ImageReport is what became of one URL in the content.
+type ImageReport struct {
+	URL         string `json:"url"`
+	Key         string `json:"key"`
+	Status      string `json:"status"`
+	Bytes       int    `json:"bytes,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	Reason      string `json:"reason,omitempty"`
+	Placeholder bool   `json:"placeholder,omitempty"`
+}
+
+// getImagePolicy applies the request's mode to the configured policy.
+func getImagePolicy(pdfParams *PDFParams) renderer.ImagePolicy {
+	policy := imagePolicy
+	if pdfParams != nil && pdfParams.ImagePolicy != "" {
+		policy.Mode = pdfParams.ImagePolicy
+	}
+	return policy
+}
+
+func imageReports(report *renderer.RenderReport) []ImageReport {
+	var images []ImageReport
+	for _, r := range report.Images {
+		images = append(images, ImageReport{
+			URL:         r.URL,
+			Key:         r.Key,
+			Status:      string(r.Status),
+			Bytes:       r.Bytes,
+			DurationMs:  r.Duration.Milliseconds(),
+			Reason:      r.Reason,
+			Placeholder: r.Placeholder,
+		})
+	}
+	return images
+}
+
+// imagesFailed reports whether an image of the render could not be inlined.
+// Such renders are not cached, so a transient failure does not stick.
+func imagesFailed(report *renderer.RenderReport) bool {
+	for _, r := range report.Images {
+		if r.Status == renderer.ImageFailed || r.Status == renderer.ImageBlocked {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageSummary counts the images of a report by status, e.g.
+// "failed=1, inlined=3", for a response header.
+func ImageSummary(images []ImageReport) string {
+	counts := map[string]int{}
+	for _, image := range images {
+		counts[image.Status]++
+	}
+	var parts []string
+	for status, n := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", status, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
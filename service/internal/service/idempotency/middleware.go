@@ -0,0 +1,195 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Zomato/espresso/service/internal/pkg/httppkg"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+const (
+	KeyHeader      = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	pollInterval = 100 * time.Millisecond
+)
+
+// replayedHeaders are the response headers stored and sent again on replay.
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Cache-Control"}
+
+type Config struct {
+	// Retention is how long a completed response is replayed for.
+	Retention time.Duration
+	// InFlightTTL bounds how long a request may hold its key, so a crashed
+	// instance does not block the key for the whole retention window.
+	InFlightTTL time.Duration
+	// Wait is how long a repeat of an in-flight request waits for the
+	// original before giving up with 409 Conflict.
+	Wait time.Duration
+	// ClientHeader names the header carrying the API client ID. Keys are
+	// scoped per client, so clients never get each other's responses.
+	ClientHeader string
+}
+
+// Middleware makes handlers idempotent for requests carrying an
+// Idempotency-Key header. Requests without the header pass straight through.
+type Middleware struct {
+	store Store
+	conf  Config
+}
+
+func NewMiddleware(store Store, conf Config) *Middleware {
+	return &Middleware{store: store, conf: conf}
+}
+
+func (m *Middleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idemKey := r.Header.Get(KeyHeader)
+		if idemKey == "" {
+			next(w, r)
+			return
+		}
+		ctx := r.Context()
+
+		if len(idemKey) > maxKeyLength {
+			httppkg.RespondWithError(w, KeyHeader+" is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httppkg.RespondWithError(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are scoped per endpoint and client, the same key on another
+		// path or from another client is unrelated
+		key := r.URL.Path + ":" + clientScope(r, m.conf.ClientHeader) + ":" + idemKey
+		fingerprint := requestFingerprint(r, body)
+
+		existing, claimed, err := m.store.Begin(ctx, key, fingerprint, time.Now().Add(m.conf.InFlightTTL))
+		if err != nil {
+			svcUtils.Logger.Error(ctx, "idempotency store unavailable", err, map[string]any{"key": idemKey})
+			httppkg.RespondWithError(w, "Failed to check idempotency key", http.StatusServiceUnavailable)
+			return
+		}
+
+		if !claimed {
+			m.repeat(w, r, key, fingerprint, existing)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(rec, r)
+
+		// server errors are not final, the client should be able to retry
+		if rec.statusCode >= http.StatusInternalServerError {
+			if err := m.store.Release(ctx, key); err != nil {
+				svcUtils.Logger.Error(ctx, "failed to release idempotency key", err, map[string]any{"key": idemKey})
+			}
+			return
+		}
+
+		header := http.Header{}
+		for _, name := range replayedHeaders {
+			if v := rec.Header().Get(name); v != "" {
+				header.Set(name, v)
+			}
+		}
+		resp := &Response{StatusCode: rec.statusCode, Header: header, Body: rec.body.Bytes()}
+		if err := m.store.Complete(ctx, key, resp, time.Now().Add(m.conf.Retention)); err != nil {
+			svcUtils.Logger.Error(ctx, "failed to store idempotent response", err, map[string]any{"key": idemKey})
+		}
+	}
+}
+
+func (m *Middleware) repeat(w http.ResponseWriter, r *http.Request, key, fingerprint string, existing *Record) {
+	ctx := r.Context()
+
+	if existing.Fingerprint != fingerprint {
+		httppkg.RespondWithError(w, KeyHeader+" was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	deadline := time.Now().Add(m.conf.Wait)
+	for existing != nil && existing.State == StateInFlight {
+		if time.Now().After(deadline) {
+			httppkg.RespondWithError(w, "A request with this "+KeyHeader+" is still in progress", http.StatusConflict)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+
+		var err error
+		if existing, err = m.store.Get(ctx, key); err != nil {
+			httppkg.RespondWithError(w, "Failed to check idempotency key", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if existing == nil {
+		// the original failed and released the key while we waited
+		httppkg.RespondWithError(w, "The original request with this "+KeyHeader+" failed, retry it", http.StatusConflict)
+		return
+	}
+
+	for name, values := range existing.Response.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(existing.Response.StatusCode)
+	w.Write(existing.Response.Body)
+}
+
+// clientScope returns the hash of the client ID in header, which has a fixed
+// length so it cannot run into the key after it.
+func clientScope(r *http.Request, header string) string {
+	var client string
+	if header != "" {
+		client = r.Header.Get(header)
+	}
+	sum := sha256.Sum256([]byte(client))
+	return hex.EncodeToString(sum[:])
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder passes the response through while keeping a copy to replay.
+type recorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
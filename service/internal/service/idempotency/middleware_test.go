@@ -0,0 +1,125 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	newRequest := func(key, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/generate-pdf", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(KeyHeader, key)
+		}
+		return req
+	}
+
+	conf := Config{Retention: time.Minute, InFlightTTL: time.Minute, Wait: time.Second}
+
+	t.Run("repeat_of_completed_request_is_replayed", func(t *testing.T) {
+		var calls int32
+		handler := NewMiddleware(NewMemoryStore(), conf).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"output_file_path":"out/1.pdf"}`))
+		})
+
+		first := httptest.NewRecorder()
+		handler(first, newRequest("key-1", `{"a":1}`))
+		second := httptest.NewRecorder()
+		handler(second, newRequest("key-1", `{"a":1}`))
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		assert.Equal(t, "true", second.Header().Get(ReplayedHeader))
+	})
+
+	t.Run("key_reused_for_different_body", func(t *testing.T) {
+		handler := NewMiddleware(NewMemoryStore(), conf).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler(httptest.NewRecorder(), newRequest("key-1", `{"a":1}`))
+		rec := httptest.NewRecorder()
+		handler(rec, newRequest("key-1", `{"a":2}`))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("server_error_releases_key", func(t *testing.T) {
+		var calls int32
+		handler := NewMiddleware(NewMemoryStore(), conf).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler(httptest.NewRecorder(), newRequest("key-1", `{}`))
+		rec := httptest.NewRecorder()
+		handler(rec, newRequest("key-1", `{}`))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("repeat_of_in_flight_request_times_out", func(t *testing.T) {
+		release := make(chan struct{})
+		handler := NewMiddleware(NewMemoryStore(), Config{Retention: time.Minute, InFlightTTL: time.Minute, Wait: 200 * time.Millisecond}).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusOK)
+		})
+
+		done := make(chan struct{})
+		go func() {
+			handler(httptest.NewRecorder(), newRequest("key-1", `{}`))
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		rec := httptest.NewRecorder()
+		handler(rec, newRequest("key-1", `{}`))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		close(release)
+		<-done
+	})
+
+	t.Run("keys_are_scoped_per_client", func(t *testing.T) {
+		clientConf := conf
+		clientConf.ClientHeader = "X-Client-Id"
+		var calls int32
+		handler := NewMiddleware(NewMemoryStore(), clientConf).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(r.Header.Get("X-Client-Id")))
+		})
+
+		for _, client := range []string{"client-a", "client-b", "client-a"} {
+			req := newRequest("key-1", `{"a":1}`)
+			req.Header.Set("X-Client-Id", client)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, client, rec.Body.String())
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("requests_without_key_pass_through", func(t *testing.T) {
+		var calls int32
+		handler := NewMiddleware(NewMemoryStore(), conf).Wrap(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+		})
+		handler(httptest.NewRecorder(), newRequest("", `{}`))
+		handler(httptest.NewRecorder(), newRequest("", `{}`))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,237 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	StateInFlight  = "in_flight"
+	StateCompleted = "completed"
+)
+
+// Response is the part of an HTTP response that is replayed for repeats.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"-"`
+}
+
+type Record struct {
+	Key         string
+	Fingerprint string
+	State       string
+	Response    *Response
+	ExpiresAt   time.Time
+}
+
+// Store persists idempotency records. Expired records are treated as absent.
+type Store interface {
+	// Begin claims key as in flight until expiresAt. If a live record
+	// already exists it is returned with claimed set to false.
+	Begin(ctx context.Context, key, fingerprint string, expiresAt time.Time) (existing *Record, claimed bool, err error)
+	// Complete stores the response for a claimed key, keeping it until
+	// expiresAt.
+	Complete(ctx context.Context, key string, resp *Response, expiresAt time.Time) error
+	// Release drops a claimed key so the request can be retried.
+	Release(ctx context.Context, key string) error
+	Get(ctx context.Context, key string) (*Record, error)
+}
+
+// MemoryStore is a Store for single instance deployments.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+func (m *MemoryStore) Begin(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if rec, ok := m.records[key]; ok && now.Before(rec.ExpiresAt) {
+		copied := *rec
+		return &copied, false, nil
+	}
+	m.sweep(now)
+
+	m.records[key] = &Record{Key: key, Fingerprint: fingerprint, State: StateInFlight, ExpiresAt: expiresAt}
+	return nil, true, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, key string, resp *Response, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[key]
+	if !ok {
+		return fmt.Errorf("idempotency key not claimed: %s", key)
+	}
+	rec.State = StateCompleted
+	rec.Response = resp
+	rec.ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[key]
+	if !ok || time.Now().After(rec.ExpiresAt) {
+		return nil, nil
+	}
+	copied := *rec
+	return &copied, nil
+}
+
+// sweep drops expired records. Called with the lock held.
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, rec := range m.records {
+		if now.After(rec.ExpiresAt) {
+			delete(m.records, key)
+		}
+	}
+}
+
+// MySQLStore is a Store shared by every service instance, backed by the
+// idempotency_keys table.
+type MySQLStore struct {
+	DB *sql.DB
+}
+
+// NewMySQLStore connects to MySQL and checks that the idempotency_keys table
+// exists.
+func NewMySQLStore(dsn string) (*MySQLStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping MySQL: %v", err)
+	}
+
+	var count int
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND table_name = 'idempotency_keys'`).Scan(&count)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check for idempotency_keys table: %v", err)
+	}
+	if count == 0 {
+		db.Close()
+		return nil, fmt.Errorf("idempotency_keys table doesn't exist in the database - please run the initialization script first")
+	}
+
+	return &MySQLStore{DB: db}, nil
+}
+
+const mysqlDuplicateEntry = 1062
+
+func (m *MySQLStore) Begin(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*Record, bool, error) {
+	// drop an expired record first so the insert below can claim the key
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idem_key = ? AND expires_at < ?", key, time.Now())
+	if err != nil {
+		return nil, false, fmt.Errorf("error expiring idempotency key: %v", err)
+	}
+
+	_, err = m.DB.ExecContext(ctx,
+		"INSERT INTO idempotency_keys (idem_key, fingerprint, state, expires_at) VALUES (?, ?, ?, ?)",
+		key, fingerprint, StateInFlight, expiresAt)
+	if err == nil {
+		return nil, true, nil
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntry {
+		return nil, false, fmt.Errorf("error claiming idempotency key: %v", err)
+	}
+
+	existing, err := m.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		// expired between the insert and the read, let the client retry
+		return &Record{Key: key, Fingerprint: fingerprint, State: StateInFlight}, false, nil
+	}
+	return existing, false, nil
+}
+
+func (m *MySQLStore) Complete(ctx context.Context, key string, resp *Response, expiresAt time.Time) error {
+	// status and headers as JSON, the body in its own column
+	meta, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotent response: %v", err)
+	}
+
+	_, err = m.DB.ExecContext(ctx,
+		"UPDATE idempotency_keys SET state = ?, response = ?, body = ?, expires_at = ? WHERE idem_key = ?",
+		StateCompleted, meta, resp.Body, expiresAt, key)
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (m *MySQLStore) Release(ctx context.Context, key string) error {
+	if _, err := m.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idem_key = ?", key); err != nil {
+		return fmt.Errorf("error releasing idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (m *MySQLStore) Get(ctx context.Context, key string) (*Record, error) {
+	rec := &Record{Key: key}
+	var response, body []byte
+
+	err := m.DB.QueryRowContext(ctx,
+		"SELECT fingerprint, state, response, body, expires_at FROM idempotency_keys WHERE idem_key = ? AND expires_at >= ?",
+		key, time.Now()).Scan(&rec.Fingerprint, &rec.State, &response, &body, &rec.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving idempotency key: %v", err)
+	}
+
+	if rec.State == StateCompleted {
+		rec.Response = &Response{}
+		if err := json.Unmarshal(response, rec.Response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal idempotent response: %v", err)
+		}
+		rec.Response.Body = body
+	}
+	return rec, nil
+}
+
+// Close closes the database connection.
+func (m *MySQLStore) Close() error {
+	if m.DB != nil {
+		return m.DB.Close()
+	}
+	return nil
+}
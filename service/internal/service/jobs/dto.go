@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRendering Status = generateDoc.StageRendering
+	StatusSigning   Status = generateDoc.StageSigning
+	StatusUploaded  Status = generateDoc.StageUploaded
+	StatusFailed    Status = "failed"
+)
+
+// IsFinal reports whether the job will not change status again.
+func (s Status) IsFinal() bool {
+	return s == StatusUploaded || s == StatusFailed
+}
+
+type Job struct {
+	JobID       string
+	Status      Status
+	Request     *generateDoc.PDFDto
+	WebhookURL  string
+	Error       string
+	QueuedAt    time.Time
+	RenderingAt time.Time
+	SigningAt   time.Time
+	CompletedAt time.Time
+}
+
+type Timings struct {
+	QueuedMs    int64 `json:"queued_ms"`
+	RenderingMs int64 `json:"rendering_ms,omitempty"`
+	SigningMs   int64 `json:"signing_ms,omitempty"`
+	TotalMs     int64 `json:"total_ms,omitempty"`
+}
+
+// JobStatus is the client facing view of a job, used both by the status
+// endpoint and as the webhook payload.
+type JobStatus struct {
+	JobID          string  `json:"job_id"`
+	Status         Status  `json:"status"`
+	OutputFilePath string  `json:"output_file_path,omitempty"`
+	PresignedURL   string  `json:"presigned_url,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	QueuedAt       string  `json:"queued_at,omitempty"`
+	CompletedAt    string  `json:"completed_at,omitempty"`
+	Timings        Timings `json:"timings"`
+}
+
+// Timings derives the per stage durations from the recorded transition times.
+// Stages that have not started yet are reported as zero.
+func (j *Job) Timings(now time.Time) Timings {
+	end := now
+	if !j.CompletedAt.IsZero() {
+		end = j.CompletedAt
+	}
+
+	var t Timings
+	queueEnd := end
+	if !j.RenderingAt.IsZero() {
+		queueEnd = j.RenderingAt
+	}
+	t.QueuedMs = queueEnd.Sub(j.QueuedAt).Milliseconds()
+
+	if !j.RenderingAt.IsZero() {
+		renderEnd := end
+		if !j.SigningAt.IsZero() {
+			renderEnd = j.SigningAt
+		}
+		t.RenderingMs = renderEnd.Sub(j.RenderingAt).Milliseconds()
+	}
+	if !j.SigningAt.IsZero() {
+		t.SigningMs = end.Sub(j.SigningAt).Milliseconds()
+	}
+	if !j.CompletedAt.IsZero() {
+		t.TotalMs = j.CompletedAt.Sub(j.QueuedAt).Milliseconds()
+	}
+	return t
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"runtime/debug"
+	"time"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/lib/utils"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+type Config struct {
+	Workers        int
+	QueueSize      int
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+	// WebhookAllowlist decides which hosts webhooks may be posted to. A nil
+	// list allows none, so jobs can only be polled.
+	WebhookAllowlist *browser_manager.Allowlist
+	// PresignExpiry is how long presigned output URLs stay valid. Zero
+	// disables presigning.
+	PresignExpiry time.Duration
+}
+
+// presigner is implemented by file stores that can hand out direct download
+// links, e.g. templatestore.S3TemplateStorage.
+type presigner interface {
+	GetPresignedURL(ctx context.Context, key string, expirySeconds int) (string, error)
+}
+
+// Runner accepts PDF generation jobs, persists them and works through them in
+// the background with a fixed number of workers.
+type Runner struct {
+	store         Store
+	templateStore *templatestore.StorageAdapter
+	fileStore     *templatestore.StorageAdapter
+	queue         chan string
+	workers       int
+	presignExpiry time.Duration
+	webhook       *webhookSender
+	generate      func(ctx context.Context, req *generateDoc.PDFDto) error
+}
+
+func NewRunner(conf Config, store Store, templateStore, fileStore *templatestore.StorageAdapter) *Runner {
+	if conf.Workers <= 0 {
+		conf.Workers = 1
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 100
+	}
+
+	return &Runner{
+		store:         store,
+		templateStore: templateStore,
+		fileStore:     fileStore,
+		queue:         make(chan string, conf.QueueSize),
+		workers:       conf.Workers,
+		presignExpiry: conf.PresignExpiry,
+		webhook:       newWebhookSender(conf.WebhookSecret, conf.WebhookTimeout, conf.WebhookAllowlist),
+		generate: func(ctx context.Context, req *generateDoc.PDFDto) error {
+			return generateDoc.GeneratePDF(ctx, req, templateStore, fileStore)
+		},
+	}
+}
+
+// Start launches the workers and re-queues every job that was still pending
+// when the service last stopped. The backlog may be larger than the queue, so
+// it is fed to the workers in the background as they free up.
+func (r *Runner) Start(ctx context.Context) error {
+	for i := 0; i < r.workers; i++ {
+		go r.work(ctx)
+	}
+
+	pending, err := r.store.ListUnfinished(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load unfinished jobs: %v", err)
+	}
+	for _, job := range pending {
+		if err := r.store.UpdateStatus(ctx, job.JobID, StatusQueued, time.Now(), ""); err != nil {
+			return err
+		}
+	}
+	go func() {
+		for _, job := range pending {
+			select {
+			case r.queue <- job.JobID:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	svcUtils.Logger.Info(ctx, "job runner started", map[string]any{"workers": r.workers, "requeued": len(pending)})
+
+	return nil
+}
+
+// Submit persists a new job for req and schedules it. The returned job ID can
+// be used to poll for its status.
+func (r *Runner) Submit(ctx context.Context, req *generateDoc.PDFDto, webhookURL string) (string, error) {
+	if webhookURL != "" {
+		u, err := url.Parse(webhookURL)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrWebhookNotAllowed, err)
+		}
+		if err := r.webhook.allowed(u); err != nil {
+			return "", err
+		}
+	}
+
+	jobID := utils.GenerateUniqueID(ctx)
+	req.ReqId = jobID
+
+	job := &Job{
+		JobID:      jobID,
+		Status:     StatusQueued,
+		Request:    req,
+		WebhookURL: webhookURL,
+		QueuedAt:   time.Now(),
+	}
+	if err := r.store.Create(ctx, job); err != nil {
+		return "", err
+	}
+
+	if err := r.enqueue(jobID); err != nil {
+		// never going to run, don't leave it behind for the next restart
+		r.finish(ctx, job, StatusFailed, err.Error())
+		return "", err
+	}
+	return jobID, nil
+}
+
+// Status returns the client facing status of a job.
+func (r *Runner) Status(ctx context.Context, jobID string) (*JobStatus, error) {
+	job, err := r.store.Get(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return r.jobStatus(ctx, job), nil
+}
+
+func (r *Runner) enqueue(jobID string) error {
+	select {
+	case r.queue <- jobID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (r *Runner) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case jobID := <-r.queue:
+			r.run(ctx, jobID)
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, jobID string) {
+	job, err := r.store.Get(ctx, jobID)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to load job", err, map[string]any{"job_id": jobID})
+		return
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err := fmt.Errorf("panic: %v and stacktrace %s", rec, string(debug.Stack()))
+			svcUtils.Logger.Error(ctx, "recovered from panic in job", err, map[string]any{"job_id": jobID})
+			r.finish(ctx, job, StatusFailed, fmt.Sprintf("panic: %v", rec))
+		}
+	}()
+
+	req := job.Request
+	req.OnStage = func(stage string) {
+		status := Status(stage)
+		if status.IsFinal() {
+			return // recorded by finish so the webhook fires once
+		}
+		if err := r.store.UpdateStatus(ctx, jobID, status, time.Now(), ""); err != nil {
+			svcUtils.Logger.Error(ctx, "failed to update job status", err, map[string]any{"job_id": jobID, "status": status})
+		}
+	}
+
+	err = r.generate(ctx, req)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "job failed", err, map[string]any{"job_id": jobID})
+		r.finish(ctx, job, StatusFailed, err.Error())
+		return
+	}
+	r.finish(ctx, job, StatusUploaded, "")
+}
+
+// finish records the final status and notifies the webhook, if any.
+func (r *Runner) finish(ctx context.Context, job *Job, status Status, errMsg string) {
+	now := time.Now()
+	if err := r.store.UpdateStatus(ctx, job.JobID, status, now, errMsg); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to update job status", err, map[string]any{"job_id": job.JobID, "status": status})
+	}
+	if job.WebhookURL == "" {
+		return
+	}
+
+	// reload for the stage timestamps recorded along the way
+	latest, err := r.store.Get(ctx, job.JobID)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "failed to reload job for webhook", err, map[string]any{"job_id": job.JobID})
+		return
+	}
+	if err := r.webhook.send(ctx, job.WebhookURL, r.jobStatus(ctx, latest)); err != nil {
+		svcUtils.Logger.Error(ctx, "failed to deliver job webhook", err, map[string]any{"job_id": job.JobID})
+	}
+}
+
+func (r *Runner) jobStatus(ctx context.Context, job *Job) *JobStatus {
+	status := &JobStatus{
+		JobID:    job.JobID,
+		Status:   job.Status,
+		Error:    job.Error,
+		QueuedAt: job.QueuedAt.Format(time.RFC3339),
+		Timings:  job.Timings(time.Now()),
+	}
+	if !job.CompletedAt.IsZero() {
+		status.CompletedAt = job.CompletedAt.Format(time.RFC3339)
+	}
+
+	if job.Status != StatusUploaded {
+		return status
+	}
+	status.OutputFilePath = job.Request.OutputTemplatePath
+
+	if p, ok := (*r.fileStore).(presigner); ok && r.presignExpiry > 0 {
+		url, err := p.GetPresignedURL(ctx, status.OutputFilePath, int(r.presignExpiry.Seconds()))
+		if err != nil {
+			svcUtils.Logger.Error(ctx, "failed to presign job output", err, map[string]any{"job_id": job.JobID})
+		} else {
+			status.PresignedURL = url
+		}
+	}
+	return status
+}
@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+	"github.com/Zomato/espresso/lib/templatestore"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store that records every status a job moves through.
+type memoryStore struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	transitions map[string][]Status
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: map[string]*Job{}, transitions: map[string][]Status{}}
+}
+
+func (m *memoryStore) Create(ctx context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *job
+	m.jobs[job.JobID] = &stored
+	m.transitions[job.JobID] = []Status{job.Status}
+	return nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, jobID string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (m *memoryStore) UpdateStatus(ctx context.Context, jobID string, status Status, at time.Time, errMsg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	job.Status, job.Error = status, errMsg
+	switch status {
+	case StatusRendering:
+		job.RenderingAt = at
+	case StatusSigning:
+		job.SigningAt = at
+	case StatusUploaded, StatusFailed:
+		job.CompletedAt = at
+	}
+	m.transitions[jobID] = append(m.transitions[jobID], status)
+	return nil
+}
+
+func (m *memoryStore) ListUnfinished(ctx context.Context) ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*Job
+	for _, job := range m.jobs {
+		if !job.Status.IsFinal() {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *memoryStore) statuses(jobID string) []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Status(nil), m.transitions[jobID]...)
+}
+
+func newTestRunner(conf Config, store Store) *Runner {
+	var fileStore templatestore.StorageAdapter = &templatestore.DiskTemplateStorage{}
+	return NewRunner(conf, store, nil, &fileStore)
+}
+
+func TestRunnerStatusTransitions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	secret := []byte("webhook-secret")
+	webhooks := make(chan *JobStatus, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := strings.TrimPrefix(r.Header.Get(SignatureHeader), "sha256=")
+		assert.Equal(t, SignWebhook(secret, r.Header.Get(TimestampHeader), body), signature)
+
+		var status JobStatus
+		assert.NoError(t, json.Unmarshal(body, &status))
+		webhooks <- &status
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	allowlist, err := browser_manager.CompileAllowlist([]string{serverURL.Host})
+	require.NoError(t, err)
+
+	store := newMemoryStore()
+	r := newTestRunner(Config{Workers: 1, WebhookSecret: string(secret), WebhookTimeout: time.Second, WebhookAllowlist: allowlist}, store)
+	r.generate = func(ctx context.Context, req *generateDoc.PDFDto) error {
+		if req.OutputTemplatePath == "out/broken.pdf" {
+			req.OnStage(generateDoc.StageRendering)
+			return errors.New("render failed")
+		}
+		req.OnStage(generateDoc.StageRendering)
+		req.OnStage(generateDoc.StageSigning)
+		req.OnStage(generateDoc.StageUploaded)
+		return nil
+	}
+	require.NoError(t, r.Start(ctx))
+
+	okID, err := r.Submit(ctx, &generateDoc.PDFDto{OutputTemplatePath: "out/1.pdf"}, server.URL)
+	require.NoError(t, err)
+	status := <-webhooks
+	assert.Equal(t, okID, status.JobID)
+	assert.Equal(t, StatusUploaded, status.Status)
+	assert.Equal(t, "out/1.pdf", status.OutputFilePath)
+	assert.Equal(t, []Status{StatusQueued, StatusRendering, StatusSigning, StatusUploaded}, store.statuses(okID))
+
+	failedID, err := r.Submit(ctx, &generateDoc.PDFDto{OutputTemplatePath: "out/broken.pdf"}, server.URL)
+	require.NoError(t, err)
+	status = <-webhooks
+	assert.Equal(t, StatusFailed, status.Status)
+	assert.Equal(t, "render failed", status.Error)
+	assert.Empty(t, status.OutputFilePath)
+	assert.Equal(t, []Status{StatusQueued, StatusRendering, StatusFailed}, store.statuses(failedID))
+
+	// webhooks only go to allowlisted hosts
+	_, err = r.Submit(ctx, &generateDoc.PDFDto{OutputTemplatePath: "out/2.pdf"}, "http://169.254.169.254/latest/meta-data")
+	assert.ErrorIs(t, err, ErrWebhookNotAllowed)
+
+	polled, err := r.Status(ctx, okID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusUploaded, polled.Status)
+	assert.NotEmpty(t, polled.CompletedAt)
+}
+
+func TestRunnerRequeuesBacklogLargerThanQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store := newMemoryStore()
+	const backlog = 10
+	for i := 0; i < backlog; i++ {
+		status := StatusQueued
+		if i%2 == 0 {
+			status = StatusRendering // in flight when the service stopped
+		}
+		require.NoError(t, store.Create(ctx, &Job{
+			JobID:    "job-" + string(rune('a'+i)),
+			Status:   status,
+			Request:  &generateDoc.PDFDto{},
+			QueuedAt: time.Now(),
+		}))
+	}
+	require.NoError(t, store.Create(ctx, &Job{JobID: "done", Status: StatusUploaded, Request: &generateDoc.PDFDto{}}))
+
+	r := newTestRunner(Config{Workers: 1, QueueSize: 2}, store)
+	release := make(chan struct{})
+	var ran atomic.Int32
+	r.generate = func(ctx context.Context, req *generateDoc.PDFDto) error {
+		<-release
+		ran.Add(1)
+		return nil
+	}
+	require.NoError(t, r.Start(ctx), "a backlog larger than the queue must not stop the service starting")
+	close(release)
+
+	require.Eventually(t, func() bool {
+		unfinished, _ := store.ListUnfinished(ctx)
+		return len(unfinished) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(backlog), ran.Load())
+	assert.Len(t, store.statuses("job-a"), 3, "created, re-queued and uploaded")
+	assert.Equal(t, StatusQueued, store.statuses("job-a")[1])
+	assert.Equal(t, []Status{StatusUploaded}, store.statuses("done"))
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"job_id":"1","status":"uploaded"}`)
+	signature := SignWebhook([]byte("secret"), "1700000000", body)
+
+	assert.Len(t, signature, 64)
+	assert.Equal(t, signature, SignWebhook([]byte("secret"), "1700000000", body))
+	assert.NotEqual(t, signature, SignWebhook([]byte("other"), "1700000000", body))
+	assert.NotEqual(t, signature, SignWebhook([]byte("secret"), "1700000001", body), "the timestamp is signed")
+	assert.NotEqual(t, signature, SignWebhook([]byte("secret"), "1700000000", append(body, ' ')))
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Store persists jobs so that queued and in-flight work survives a restart.
+type Store interface {
+	Create(ctx context.Context, job *Job) error
+	Get(ctx context.Context, jobID string) (*Job, error)
+	// UpdateStatus records a transition to status at the given time.
+	UpdateStatus(ctx context.Context, jobID string, status Status, at time.Time, errMsg string) error
+	// ListUnfinished returns every job that has not reached a final status.
+	ListUnfinished(ctx context.Context) ([]*Job, error)
+}
+
+// MySQLStore implements Store on top of the pdf_jobs table.
+type MySQLStore struct {
+	DB *sql.DB
+}
+
+// NewMySQLStore connects to MySQL and checks that the pdf_jobs table exists.
+func NewMySQLStore(dsn string) (*MySQLStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping MySQL: %v", err)
+	}
+
+	var count int
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND table_name = 'pdf_jobs'`).Scan(&count)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check for pdf_jobs table: %v", err)
+	}
+	if count == 0 {
+		db.Close()
+		return nil, fmt.Errorf("pdf_jobs table doesn't exist in the database - please run the initialization script first")
+	}
+
+	return &MySQLStore{DB: db}, nil
+}
+
+func (m *MySQLStore) Create(ctx context.Context, job *Job) error {
+	request, err := json.Marshal(job.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job request: %v", err)
+	}
+
+	_, err = m.DB.ExecContext(ctx,
+		"INSERT INTO pdf_jobs (job_id, status, request, webhook_url, queued_at) VALUES (?, ?, ?, ?, ?)",
+		job.JobID, job.Status, request, job.WebhookURL, job.QueuedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting job into database: %v", err)
+	}
+	return nil
+}
+
+const selectJobColumns = "SELECT job_id, status, request, webhook_url, error, queued_at, rendering_at, signing_at, completed_at FROM pdf_jobs"
+
+func (m *MySQLStore) Get(ctx context.Context, jobID string) (*Job, error) {
+	job, err := scanJob(m.DB.QueryRowContext(ctx, selectJobColumns+" WHERE job_id = ?", jobID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("error retrieving job: %v", err)
+	}
+	return job, nil
+}
+
+func (m *MySQLStore) UpdateStatus(ctx context.Context, jobID string, status Status, at time.Time, errMsg string) error {
+	var query string
+	switch status {
+	case StatusQueued:
+		// re-queued after a restart, earlier stage timings no longer apply
+		query = "UPDATE pdf_jobs SET status = ?, error = ?, rendering_at = NULL, signing_at = NULL, queued_at = ? WHERE job_id = ?"
+	case StatusRendering:
+		query = "UPDATE pdf_jobs SET status = ?, error = ?, rendering_at = ? WHERE job_id = ?"
+	case StatusSigning:
+		query = "UPDATE pdf_jobs SET status = ?, error = ?, signing_at = ? WHERE job_id = ?"
+	case StatusUploaded, StatusFailed:
+		query = "UPDATE pdf_jobs SET status = ?, error = ?, completed_at = ? WHERE job_id = ?"
+	default:
+		return fmt.Errorf("unknown job status: %s", status)
+	}
+
+	if _, err := m.DB.ExecContext(ctx, query, status, errMsg, at, jobID); err != nil {
+		return fmt.Errorf("error updating job status: %v", err)
+	}
+	return nil
+}
+
+func (m *MySQLStore) ListUnfinished(ctx context.Context) ([]*Job, error) {
+	rows, err := m.DB.QueryContext(ctx, selectJobColumns+" WHERE status NOT IN (?, ?) ORDER BY queued_at", StatusUploaded, StatusFailed)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning job row: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job rows: %v", err)
+	}
+	return jobs, nil
+}
+
+// Close closes the database connection.
+func (m *MySQLStore) Close() error {
+	if m.DB != nil {
+		return m.DB.Close()
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var request []byte
+	var webhookURL, errMsg sql.NullString
+	var renderingAt, signingAt, completedAt sql.NullTime
+
+	if err := row.Scan(&job.JobID, &job.Status, &request, &webhookURL, &errMsg,
+		&job.QueuedAt, &renderingAt, &signingAt, &completedAt); err != nil {
+		return nil, err
+	}
+
+	job.Request = &generateDoc.PDFDto{}
+	if err := json.Unmarshal(request, job.Request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job request: %v", err)
+	}
+	job.WebhookURL = webhookURL.String
+	job.Error = errMsg.String
+	job.RenderingAt = renderingAt.Time
+	job.SigningAt = signingAt.Time
+	job.CompletedAt = completedAt.Time
+
+	return &job, nil
+}
@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Zomato/espresso/lib/browser_manager"
+)
+
+// ErrWebhookNotAllowed is returned for webhook URLs that the webhook
+// allowlist does not allow.
+var ErrWebhookNotAllowed = errors.New("webhook url not allowed")
+
+const (
+	SignatureHeader = "X-Espresso-Signature"
+	TimestampHeader = "X-Espresso-Timestamp"
+
+	webhookAttempts = 3
+)
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers should recompute it with the shared secret and compare in
+// constant time before trusting the payload.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookSender struct {
+	secret    []byte
+	client    *http.Client
+	allowlist *browser_manager.Allowlist
+}
+
+func newWebhookSender(secret string, timeout time.Duration, allowlist *browser_manager.Allowlist) *webhookSender {
+	w := &webhookSender{secret: []byte(secret), allowlist: allowlist}
+	w.client = &http.Client{
+		Timeout: timeout,
+		// a redirect must not lead the post somewhere the client could not
+		// have pointed it
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return w.allowed(req.URL)
+		},
+	}
+	return w
+}
+
+// allowed returns ErrWebhookNotAllowed, wrapped with the reason, unless the
+// webhook allowlist allows u.
+func (w *webhookSender) allowed(u *url.URL) error {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("%w: scheme %s", ErrWebhookNotAllowed, u.Scheme)
+	}
+	if ok, reason := w.allowlist.Allows(u); !ok {
+		return fmt.Errorf("%w: %s", ErrWebhookNotAllowed, reason)
+	}
+	return nil
+}
+
+// send posts the job status to webhookURL, retrying transient failures with a
+// linear backoff.
+func (w *webhookSender) send(ctx context.Context, webhookURL string, status *JobStatus) error {
+	// checked again, as jobs re-queued on restart were accepted under the
+	// allowlist of the time
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookNotAllowed, err)
+	}
+	if err := w.allowed(u); err != nil {
+		return err
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if lastErr = w.post(ctx, webhookURL, body); lastErr == nil {
+			return nil
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	return fmt.Errorf("webhook delivery failed after %d attempts: %v", webhookAttempts, lastErr)
+}
+
+func (w *webhookSender) post(ctx context.Context, webhookURL string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+SignWebhook(w.secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package pdfcache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Zomato/espresso/lib/templatestore"
+)
+
+// MemoryBackend is an LRU bounded by both entry count and total bytes.
+type MemoryBackend struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry []byte
+}
+
+func NewMemoryBackend(maxEntries int, maxBytes int64) *MemoryBackend {
+	return &MemoryBackend{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (m *MemoryBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true, nil
+}
+
+func (m *MemoryBackend) Set(ctx context.Context, key string, entry []byte) error {
+	if m.maxBytes > 0 && int64(len(entry)) > m.maxBytes {
+		return nil // would evict everything else and still not fit
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, entry: entry})
+	m.size += int64(len(entry))
+
+	for (m.maxEntries > 0 && m.order.Len() > m.maxEntries) || (m.maxBytes > 0 && m.size > m.maxBytes) {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *MemoryBackend) remove(el *list.Element) {
+	item := m.order.Remove(el).(*memoryItem)
+	delete(m.items, item.key)
+	m.size -= int64(len(item.entry))
+}
+
+// DiskBackend keeps one file per entry in a directory. Expired files are
+// not swept; they are ignored on read and overwritten on the next miss.
+type DiskBackend struct {
+	dir string
+}
+
+func NewDiskBackend(dir string) (*DiskBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &DiskBackend{dir: dir}, nil
+}
+
+func (d *DiskBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, err := os.ReadFile(filepath.Join(d.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+func (d *DiskBackend) Set(ctx context.Context, key string, entry []byte) error {
+	// write then rename so readers never see a partial entry
+	tmp, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(entry); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.dir, key))
+}
+
+// StoreBackend keeps entries in a file storage adapter (disk or S3) under a
+// path prefix. With S3, a lifecycle rule on the prefix can reclaim space.
+type StoreBackend struct {
+	store  *templatestore.StorageAdapter
+	prefix string
+}
+
+func NewStoreBackend(store *templatestore.StorageAdapter, prefix string) (*StoreBackend, error) {
+	if _, ok := (*store).(*templatestore.StreamStorage); ok {
+		return nil, errors.New("the store cache backend needs a disk or s3 file storage, not stream")
+	}
+	return &StoreBackend{store: store, prefix: prefix}, nil
+}
+
+func (s *StoreBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path := s.prefix + key
+	reader, err := (*s.store).GetDocument(ctx, &templatestore.GetDocumentRequest{FilePath: path, FileS3Path: path})
+	if err != nil {
+		// the adapters do not distinguish a missing object from a failure
+		return nil, false, nil
+	}
+	if c, ok := reader.(io.Closer); ok {
+		defer c.Close()
+	}
+	entry, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *StoreBackend) Set(ctx context.Context, key string, entry []byte) error {
+	path := s.prefix + key
+	var reader io.Reader = bytes.NewReader(entry)
+	_, err := (*s.store).PutDocument(ctx, &templatestore.PostDocumentRequest{FilePath: path, FileS3Path: path}, &reader)
+	return err
+}
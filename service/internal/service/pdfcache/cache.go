@@ -0,0 +1,134 @@
+package pdfcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	svcUtils "github.com/Zomato/espresso/service/utils"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendDisk   = "disk"
+	BackendStore  = "store"
+)
+
+// Backend stores cache entries. Entries are opaque to the backend; expiry is
+// encoded in the entry itself so backends without native TTLs work too.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, entry []byte) error
+}
+
+// Cache holds rendered PDFs keyed by everything that determines their bytes.
+type Cache struct {
+	backend Backend
+	ttl     time.Duration
+}
+
+func New(backend Backend, ttl time.Duration) *Cache {
+	return &Cache{backend: backend, ttl: ttl}
+}
+
+// KeyInput is everything that determines the output of a render.
+type KeyInput struct {
+	TemplateID      string
+	TemplateVersion string
+	Content         []byte
+	// Params holds the PDF, viewport and any other render options. It is
+	// JSON encoded, so it must encode deterministically.
+	Params any
+	// SignedWith is the certificate key for cached signed outputs, empty for
+	// unsigned ones.
+	SignedWith string
+}
+
+// Key derives the cache key for in. Content is canonicalised first so that
+// key order and whitespace in the JSON do not cause misses.
+func Key(in KeyInput) (string, error) {
+	contentHash, err := canonicalHash(in.Content)
+	if err != nil {
+		return "", err
+	}
+	params, err := json.Marshal(in.Params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode params for cache key: %v", err)
+	}
+
+	h := sha256.New()
+	for _, part := range []string{in.TemplateID, in.TemplateVersion, contentHash, string(params), in.SignedWith} {
+		// length prefixed so that parts cannot run into each other
+		binary.Write(h, binary.BigEndian, uint64(len(part)))
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func canonicalHash(content []byte) (string, error) {
+	if len(content) == 0 {
+		content = []byte(`{}`)
+	}
+	var v any
+	if err := json.Unmarshal(content, &v); err != nil {
+		return "", fmt.Errorf("content is not valid JSON: %v", err)
+	}
+	// encoding/json writes map keys in sorted order
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get returns the cached PDF for key, if present and not expired. Backend
+// errors are logged and reported as a miss so the cache never fails a render.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	entry, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		svcUtils.Logger.Error(ctx, "pdf cache get failed", err, map[string]any{"key": key})
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	pdf, err := decodeEntry(entry, time.Now())
+	if err != nil {
+		return nil, false
+	}
+	return pdf, true
+}
+
+// Set stores pdf under key for the configured TTL.
+func (c *Cache) Set(ctx context.Context, key string, pdf []byte) {
+	if err := c.backend.Set(ctx, key, encodeEntry(pdf, time.Now().Add(c.ttl))); err != nil {
+		svcUtils.Logger.Error(ctx, "pdf cache set failed", err, map[string]any{"key": key})
+	}
+}
+
+var errExpired = errors.New("cache entry expired")
+
+// An entry is the expiry as unix nanoseconds followed by the PDF bytes.
+func encodeEntry(pdf []byte, expiresAt time.Time) []byte {
+	entry := make([]byte, 8+len(pdf))
+	binary.BigEndian.PutUint64(entry, uint64(expiresAt.UnixNano()))
+	copy(entry[8:], pdf)
+	return entry
+}
+
+func decodeEntry(entry []byte, now time.Time) ([]byte, error) {
+	if len(entry) < 8 {
+		return nil, errors.New("cache entry is truncated")
+	}
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(entry)))
+	if now.After(expiresAt) {
+		return nil, errExpired
+	}
+	return entry[8:], nil
+}
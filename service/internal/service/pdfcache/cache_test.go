@@ -0,0 +1,80 @@
+package pdfcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	base := KeyInput{
+		TemplateID:      "uuid:template-1-uuid",
+		TemplateVersion: "2025-03-07T00:00:00Z",
+		Content:         []byte(`{"a":1,"b":{"c":"d"}}`),
+		Params:          map[string]any{"landscape": false},
+	}
+	baseKey, err := Key(base)
+	require.NoError(t, err)
+
+	reordered := base
+	reordered.Content = []byte(`{ "b": {"c": "d"}, "a": 1 }`)
+	key, err := Key(reordered)
+	require.NoError(t, err)
+	assert.Equal(t, baseKey, key, "key order and whitespace should not change the key")
+
+	newVersion := base
+	newVersion.TemplateVersion = "2025-03-08T00:00:00Z"
+	key, err = Key(newVersion)
+	require.NoError(t, err)
+	assert.NotEqual(t, baseKey, key)
+
+	signed := base
+	signed.SignedWith = "digital_certificates.cert1"
+	key, err = Key(signed)
+	require.NoError(t, err)
+	assert.NotEqual(t, baseKey, key)
+
+	invalid := base
+	invalid.Content = []byte(`{not json`)
+	_, err = Key(invalid)
+	assert.Error(t, err)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lru_eviction", func(t *testing.T) {
+		cache := New(NewMemoryBackend(2, 0), time.Minute)
+		cache.Set(ctx, "a", []byte("pdf-a"))
+		cache.Set(ctx, "b", []byte("pdf-b"))
+		_, ok := cache.Get(ctx, "a") // a is now most recently used
+		require.True(t, ok)
+		cache.Set(ctx, "c", []byte("pdf-c"))
+
+		_, ok = cache.Get(ctx, "b")
+		assert.False(t, ok, "least recently used entry should be evicted")
+		pdf, ok := cache.Get(ctx, "a")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("pdf-a"), pdf)
+	})
+
+	t.Run("expired_entry_is_a_miss", func(t *testing.T) {
+		cache := New(NewMemoryBackend(0, 0), -time.Second)
+		cache.Set(ctx, "a", []byte("pdf-a"))
+		_, ok := cache.Get(ctx, "a")
+		assert.False(t, ok)
+	})
+
+	t.Run("disk_backend", func(t *testing.T) {
+		backend, err := NewDiskBackend(t.TempDir())
+		require.NoError(t, err)
+		cache := New(backend, time.Minute)
+		cache.Set(ctx, "a", []byte("pdf-a"))
+		pdf, ok := cache.Get(ctx, "a")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("pdf-a"), pdf)
+	})
+}
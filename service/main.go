@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Zomato/espresso/lib/browser_manager"
 
 	logger "github.com/Zomato/espresso/lib/logger"
+	"github.com/Zomato/espresso/lib/renderer"
 	"github.com/Zomato/espresso/lib/workerpool"
 	"github.com/Zomato/espresso/service/controller/pdf_generation"
 	"github.com/Zomato/espresso/service/internal/pkg/viperpkg"
+	"github.com/Zomato/espresso/service/internal/service/generateDoc"
 	"github.com/Zomato/espresso/service/utils"
 	"github.com/spf13/viper"
 )
@@ -31,12 +39,60 @@ func main() {
 	fileStorageType := viper.GetString("file_storage.storage_type")
 	zeroLog.Info(ctx, "File storage type ", map[string]any{"type": fileStorageType})
 
-	browser_manager.SetAllowedDomains(viper.GetStringSlice("prefetch_images.allowed_domains"))
-
-	tabpool := viper.GetInt("browser.tab_pool")
-	if err := browser_manager.Init(ctx, tabpool); err != nil {
+	if err := browser_manager.SetAllowedDomains(viper.GetStringSlice("prefetch_images.allowed_domains")); err != nil {
+		log.Fatalf("Invalid prefetch_images.allowed_domains: %v", err)
+	}
+	if err := renderer.ConfigureImageFetch(renderer.ImageFetchConfig{
+		Timeout:         time.Duration(viper.GetInt("prefetch_images.timeout")) * time.Millisecond,
+		MaxImageBytes:   viper.GetInt64("prefetch_images.max_image_bytes"),
+		MaxRequestBytes: viper.GetInt64("prefetch_images.max_request_bytes"),
+		CacheEntries:    viper.GetInt("prefetch_images.cache_entries"),
+		CacheBytes:      viper.GetInt64("prefetch_images.cache_bytes"),
+		CacheTTL:        time.Duration(viper.GetInt("prefetch_images.cache_ttl")) * time.Second,
+		CacheDir:        viper.GetString("prefetch_images.cache_dir"),
+	}); err != nil {
+		log.Fatalf("Invalid prefetch_images settings: %v", err)
+	}
+	policy, err := imagePolicy()
+	if err != nil {
+		log.Fatalf("Invalid prefetch_images.policy: %v", err)
+	}
+	generateDoc.SetImagePolicy(policy)
+	templateAllowlists, err := loadAllowlists("allowlists.templates")
+	if err != nil {
+		log.Fatalf("Invalid allowlists.templates: %v", err)
+	}
+	clientAllowlists, err := loadAllowlists("allowlists.clients")
+	if err != nil {
+		log.Fatalf("Invalid allowlists.clients: %v", err)
+	}
+	generateDoc.SetAllowlists(templateAllowlists, clientAllowlists)
+
+	browser, err := browser_manager.New(ctx, browser_manager.Config{
+		Browsers:       viper.GetInt("browser.count"),
+		TabsPerBrowser: viper.GetInt("browser.tab_pool"),
+		UserDataDir:    viper.GetString("browser.user_data_dir"),
+		Isolation:      viper.GetString("browser.isolation"),
+		Launch:         browserLaunchConfig(),
+		Remote:         remoteBrowserConfig(),
+		Queue: browser_manager.QueueConfig{
+			MaxQueueDepth:  viper.GetInt("browser.max_queue_depth"),
+			AcquireTimeout: time.Duration(viper.GetInt("browser.acquire_timeout")) * time.Millisecond,
+		},
+		Lifecycle: browser_manager.LifecycleConfig{
+			ProbeTimeout: time.Duration(viper.GetInt("browser.tab_probe_timeout")) * time.Millisecond,
+			MaxRenders:   viper.GetInt("browser.tab_max_renders"),
+			MaxHeapBytes: viper.GetInt64("browser.tab_max_heap_bytes"),
+		},
+		Supervisor: browser_manager.SupervisorConfig{
+			PingInterval: time.Duration(viper.GetInt("browser.ping_interval")) * time.Millisecond,
+			PingFailures: viper.GetInt("browser.ping_failures"),
+		},
+	})
+	if err != nil {
 		log.Fatalf("Failed to initialize browser: %v", err)
 	}
+	defer browser.Close()
 	workerCount := viper.GetInt("workerpool.worker_count")
 	workerTimeout := viper.GetInt("workerpool.worker_timeout")
 
@@ -46,7 +102,7 @@ func main() {
 	// Create a new ServeMux
 	mux := http.NewServeMux()
 
-	pdf_generation.Register(mux)
+	pdf_generation.Register(mux, browser)
 	// Wrap the entire mux with the CORS middleware
 	corsHandler := enableCORS(mux)
 
@@ -60,6 +116,97 @@ func main() {
 	zeroLog.Info(ctx, "Server terminated", nil)
 }
 
+// browserLaunchConfig reads the flags launched browsers are started with.
+// browser_manager.New rejects an invalid combination at startup.
+func browserLaunchConfig() browser_manager.LaunchConfig {
+	return browser_manager.LaunchConfig{
+		Preset:       viper.GetString("browser.preset"),
+		Flags:        viper.GetStringMapString("browser.flags"),
+		RemoveFlags:  viper.GetStringSlice("browser.remove_flags"),
+		WindowWidth:  viper.GetInt("browser.window_width"),
+		WindowHeight: viper.GetInt("browser.window_height"),
+		Locale:       viper.GetString("browser.locale"),
+		Timezone:     viper.GetString("browser.timezone"),
+		Proxy:        viper.GetString("browser.proxy"),
+		ProxyBypass:  viper.GetString("browser.proxy_bypass"),
+	}
+}
+
+// loadAllowlists compiles the allowlists under key, keyed by the template
+// or client ID each applies to.
+func loadAllowlists(key string) (map[string]*browser_manager.Allowlist, error) {
+	var entries []struct {
+		ID             string   `mapstructure:"id"`
+		AllowedDomains []string `mapstructure:"allowed_domains"`
+	}
+	if err := viper.UnmarshalKey(key, &entries); err != nil {
+		return nil, err
+	}
+
+	lists := map[string]*browser_manager.Allowlist{}
+	for _, entry := range entries {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("entry without an id")
+		}
+		list, err := browser_manager.CompileAllowlist(entry.AllowedDomains)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.ID, err)
+		}
+		lists[entry.ID] = list
+	}
+	return lists, nil
+}
+
+// imagePolicy reads prefetch_images.policy and the placeholder image from the
+// file at prefetch_images.placeholder.
+func imagePolicy() (renderer.ImagePolicy, error) {
+	policy := renderer.ImagePolicy{Mode: viper.GetString("prefetch_images.policy")}
+	switch policy.Mode {
+	case "", renderer.ImagesLenient, renderer.ImagesStrict, renderer.ImagesPlaceholder:
+	default:
+		return policy, fmt.Errorf("unknown policy %q", policy.Mode)
+	}
+
+	path := viper.GetString("prefetch_images.placeholder")
+	if path == "" {
+		return policy, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read placeholder: %v", err)
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return policy, fmt.Errorf("placeholder %s is not an image", path)
+	}
+	policy.Placeholder = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content)
+	return policy, nil
+}
+
+// remoteBrowserConfig reads browser.remote_url and browser.remote_urls. With
+// either set, the service connects to those browsers instead of launching
+// Chrome itself.
+func remoteBrowserConfig() browser_manager.RemoteConfig {
+	urls := viper.GetStringSlice("browser.remote_urls")
+	if u := viper.GetString("browser.remote_url"); u != "" {
+		urls = append([]string{u}, urls...)
+	}
+
+	header := http.Header{}
+	for name, value := range viper.GetStringMapString("browser.remote_headers") {
+		header.Set(name, value)
+	}
+
+	return browser_manager.RemoteConfig{
+		URLs:        urls,
+		Header:      header,
+		DialTimeout: time.Duration(viper.GetInt("browser.remote_dial_timeout")) * time.Millisecond,
+	}
+}
+
 func initializeWorkerPool(workerCount int, workerTimeout int) {
 	concurrency := workerCount
 
@@ -8,6 +8,41 @@ CREATE TABLE IF NOT EXISTS templates (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
 
+-- Create assets table used by templates through espresso-asset:// and relative URLs
+CREATE TABLE IF NOT EXISTS template_assets (
+    template_id VARCHAR(255) NOT NULL,
+    path VARCHAR(512) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    content LONGBLOB NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (template_id, path)
+);
+
+-- Create jobs table used by the async /jobs API
+CREATE TABLE IF NOT EXISTS pdf_jobs (
+    job_id VARCHAR(64) PRIMARY KEY,
+    status VARCHAR(32) NOT NULL,
+    request MEDIUMBLOB NOT NULL,
+    webhook_url VARCHAR(2048),
+    error TEXT,
+    queued_at DATETIME(3) NOT NULL,
+    rendering_at DATETIME(3) NULL,
+    signing_at DATETIME(3) NULL,
+    completed_at DATETIME(3) NULL,
+    INDEX idx_pdf_jobs_status (status)
+);
+
+-- Create idempotency table used when idempotency.store is mysql
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idem_key VARCHAR(512) PRIMARY KEY,
+    fingerprint CHAR(64) NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    response TEXT NULL,
+    body LONGBLOB NULL,
+    expires_at DATETIME(3) NOT NULL,
+    INDEX idx_idempotency_keys_expires_at (expires_at)
+);
+
 -- Insert a basic sample template
 INSERT INTO templates (template_id,template_name, template_content,json_schema)
 VALUES ('template-1-uuid', "Registration Form Template",